@@ -0,0 +1,319 @@
+// Package asm assembles the mnemonics written by the disasm package back into a CHIP-8 program.
+//
+// A source file holds one statement per line. Comments start with a semicolon. A line may start with labels, written
+// "name:", which are bound to the address of the statement that follows. Besides the instructions, the assembler knows:
+//
+//	name = expression        defines a constant
+//	db expression, ...       emits bytes
+//	dw expression, ...       emits big-endian 16 bits words
+//	include "file"           assembles another file in place, relative to the including one
+//
+// An expression adds and subtracts numbers, labels and constants. Numbers are decimal, hex when prefixed with 0x, or binary
+// when prefixed with 0b. Mnemonics, registers and keywords are case insensitive, labels and constants are not.
+package asm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Origin is the address the programs are loaded at.
+const Origin rune = 0x200
+
+// maxInclude is the maximum nesting of include directives, which stops include cycles.
+const maxInclude = 16
+
+// A Line is a position in a source file.
+type Line struct {
+	File string
+	Line int
+}
+
+func (l Line) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// A Program is the result of an assembly.
+type Program struct {
+	Bytes   []byte          // loaded at Origin
+	Symbols map[string]rune // labels and constants
+	Lines   map[rune]Line   // source line of the statement at each address
+}
+
+// Error reports the position of an assembly error.
+type Error struct {
+	Line Line
+	Err  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Line, e.Err)
+}
+
+// statement is an instruction or a data directive, sized by the first pass and encoded by the second one.
+type statement struct {
+	line     Line
+	mnemonic string // upper case
+	operands []string
+	addr     rune
+	size     int
+}
+
+type assembler struct {
+	statements []*statement
+	labels     map[string]rune
+	constants  map[string]string
+	order      []string // constants by order of definition
+	defined    map[string]Line
+	addr       rune
+}
+
+// AssembleFile assembles the source file at path.
+func AssembleFile(path string) (*Program, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Assemble(path, src)
+}
+
+// Assemble assembles src, read from the file name. The included files are looked up relative to the directory of name.
+func Assemble(name string, src []byte) (*Program, error) {
+	a := &assembler{
+		labels:    make(map[string]rune),
+		constants: make(map[string]string),
+		defined:   make(map[string]Line),
+		addr:      Origin,
+	}
+
+	if err := a.parse(name, src, 0); err != nil {
+		return nil, err
+	}
+
+	p := &Program{
+		Symbols: make(map[string]rune),
+		Lines:   make(map[rune]Line),
+	}
+
+	for name, addr := range a.labels {
+		p.Symbols[name] = addr
+	}
+
+	for _, name := range a.order {
+		v, err := a.eval(a.constants[name], 0)
+		if err != nil {
+			return nil, &Error{a.defined[name], err.Error()}
+		}
+		p.Symbols[name] = rune(v)
+	}
+
+	for _, s := range a.statements {
+		b, err := a.encode(s)
+		if err != nil {
+			return nil, &Error{s.line, err.Error()}
+		}
+
+		if len(b) != s.size {
+			return nil, &Error{s.line, fmt.Sprintf("%s is %d bytes, %d expected", s.mnemonic, len(b), s.size)}
+		}
+
+		p.Lines[s.addr] = s.line
+		p.Bytes = append(p.Bytes, b...)
+	}
+
+	return p, nil
+}
+
+// parse is the first pass: it binds the labels to their addresses and records the constants and the statements.
+func (a *assembler) parse(name string, src []byte, depth int) error {
+	for i, text := range strings.Split(string(src), "\n") {
+		line := Line{name, i + 1}
+
+		if j := strings.Index(text, ";"); j >= 0 {
+			text = text[:j]
+		}
+		text = strings.TrimSpace(text)
+
+		for {
+			j := strings.Index(text, ":")
+			if j < 0 || !isIdent(strings.TrimSpace(text[:j])) {
+				break
+			}
+
+			label := strings.TrimSpace(text[:j])
+			if err := a.define(label, line); err != nil {
+				return err
+			}
+			a.labels[label] = a.addr
+			text = strings.TrimSpace(text[j+1:])
+		}
+
+		if text == "" {
+			continue
+		}
+
+		if j := strings.Index(text, "="); j >= 0 && isIdent(strings.TrimSpace(text[:j])) {
+			constant := strings.TrimSpace(text[:j])
+			if err := a.define(constant, line); err != nil {
+				return err
+			}
+			a.constants[constant] = strings.TrimSpace(text[j+1:])
+			a.order = append(a.order, constant)
+			continue
+		}
+
+		mnemonic, rest := text, ""
+		if j := strings.IndexAny(text, " \t"); j >= 0 {
+			mnemonic, rest = text[:j], text[j+1:]
+		}
+		mnemonic = strings.ToUpper(mnemonic)
+
+		var operands []string
+		if rest = strings.TrimSpace(rest); rest != "" {
+			for _, op := range strings.Split(rest, ",") {
+				operands = append(operands, strings.TrimSpace(op))
+			}
+		}
+
+		if mnemonic == "INCLUDE" {
+			if err := a.include(line, operands, depth); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s := &statement{line: line, mnemonic: mnemonic, operands: operands, addr: a.addr, size: size(mnemonic, operands)}
+		a.statements = append(a.statements, s)
+		a.addr += rune(s.size)
+	}
+
+	return nil
+}
+
+func (a *assembler) include(line Line, operands []string, depth int) error {
+	if len(operands) != 1 || len(operands[0]) < 2 || operands[0][0] != '"' || operands[0][len(operands[0])-1] != '"' {
+		return &Error{line, `include expects a quoted file name`}
+	}
+
+	if depth >= maxInclude {
+		return &Error{line, "too many nested includes"}
+	}
+
+	path := operands[0][1 : len(operands[0])-1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(line.File), path)
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &Error{line, err.Error()}
+	}
+
+	return a.parse(path, src, depth+1)
+}
+
+func (a *assembler) define(name string, line Line) error {
+	if isRegister(name) || keywords[strings.ToUpper(name)] {
+		return &Error{line, fmt.Sprintf("%s is reserved", name)}
+	}
+
+	if prev, ok := a.defined[name]; ok {
+		return &Error{line, fmt.Sprintf("%s already defined at %s", name, prev)}
+	}
+
+	a.defined[name] = line
+	return nil
+}
+
+// eval computes an expression of numbers and symbols added or subtracted.
+func (a *assembler) eval(expr string, depth int) (int, error) {
+	if depth > len(a.constants) {
+		return 0, fmt.Errorf("constant %s is defined by itself", expr)
+	}
+
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return 0, fmt.Errorf("missing operand")
+	}
+
+	result, sign := 0, 1
+	for expr != "" {
+		j := strings.IndexAny(expr, "+-")
+		if j == 0 {
+			return 0, fmt.Errorf("invalid expression")
+		}
+		term := expr
+		if j > 0 {
+			term = expr[:j]
+		}
+
+		v, err := a.term(strings.TrimSpace(term), depth)
+		if err != nil {
+			return 0, err
+		}
+		result += sign * v
+
+		if j < 0 {
+			break
+		}
+		sign = 1
+		if expr[j] == '-' {
+			sign = -1
+		}
+		expr = strings.TrimSpace(expr[j+1:])
+		if expr == "" {
+			return 0, fmt.Errorf("invalid expression")
+		}
+	}
+
+	return result, nil
+}
+
+func (a *assembler) term(term string, depth int) (int, error) {
+	if addr, ok := a.labels[term]; ok {
+		return int(addr), nil
+	}
+
+	if expr, ok := a.constants[term]; ok {
+		return a.eval(expr, depth+1)
+	}
+
+	base, digits := 10, term
+	switch {
+	case strings.HasPrefix(strings.ToLower(term), "0x"):
+		base, digits = 16, term[2:]
+	case strings.HasPrefix(strings.ToLower(term), "0b"):
+		base, digits = 2, term[2:]
+	}
+
+	v, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		if isIdent(term) {
+			return 0, fmt.Errorf("undefined symbol %s", term)
+		}
+		return 0, fmt.Errorf("invalid number %s", term)
+	}
+
+	return int(v), nil
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
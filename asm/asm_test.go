@@ -0,0 +1,167 @@
+package asm
+
+import (
+	"bytes"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for opcode := 0; opcode <= 0xFFFF; opcode++ {
+		b := []byte{byte(opcode >> 8), byte(opcode), 0x12, 0x34}
+		in := disasm.Decode(b, Origin)
+		if !in.Valid {
+			continue
+		}
+
+		p, err := Assemble("test.asm", []byte(in.Mnemonic))
+		if err != nil {
+			t.Errorf("%q should assemble, actual: %s\n", in.Mnemonic, err)
+			continue
+		}
+
+		if !bytes.Equal(p.Bytes, in.Bytes) {
+			t.Errorf("%q should assemble to % X, actual: % X\n", in.Mnemonic, in.Bytes, p.Bytes)
+		}
+	}
+
+	data := disasm.Data([]byte{0x00, 0xFF, 0x7A}, Origin)
+	if p, err := Assemble("test.asm", []byte(data.Mnemonic)); err != nil || !bytes.Equal(p.Bytes, data.Bytes) {
+		t.Errorf("%q should assemble to % X, actual: %v %v\n", data.Mnemonic, data.Bytes, p, err)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	src := `; draws a digit
+digit = 0x0A
+offset = sprite - start
+
+start:	ld v0, digit       ; lower case is accepted
+	LD F, V0
+loop:	DRW V1, V2, 5
+	ADD V1, 0x05
+	SE V1, 0x3C
+	JP loop
+	LD I, sprite + 2
+end:	JP end
+sprite:
+	db 0b11110000, 0x90, offset
+	dw 0x1234, end
+	SHR V3
+`
+	expected := []byte{
+		0x60, 0x0A,
+		0xF0, 0x29,
+		0xD1, 0x25,
+		0x71, 0x05,
+		0x31, 0x3C,
+		0x12, 0x04,
+		0xA2, 0x12,
+		0x12, 0x0E,
+		0xF0, 0x90, 0x10,
+		0x12, 0x34, 0x02, 0x0E,
+		0x83, 0x36,
+	}
+
+	p, err := Assemble("draw.asm", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(p.Bytes, expected) {
+		t.Errorf("program should be % X, actual: % X\n", expected, p.Bytes)
+	}
+
+	if p.Symbols["loop"] != 0x204 || p.Symbols["offset"] != 0x10 {
+		t.Errorf("loop should be 0x204 and offset 0x10, actual: 0x%03X and 0x%X\n", p.Symbols["loop"], p.Symbols["offset"])
+	}
+
+	if line := p.Lines[0x20E]; line.File != "draw.asm" || line.Line != 12 {
+		t.Errorf("0x20E should map to draw.asm:12, actual: %s\n", line)
+	}
+}
+
+func TestAssembleLongSymbols(t *testing.T) {
+	src := `LD I, longtable
+longv = 5
+	LD V0, longv
+	LD I, LONG longtable
+longtable:
+	db 1
+`
+	expected := []byte{0xA2, 0x08, 0x60, 0x05, 0xF0, 0x00, 0x02, 0x08, 0x01}
+
+	p, err := Assemble("long.asm", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(p.Bytes, expected) {
+		t.Errorf("program should be % X, actual: % X\n", expected, p.Bytes)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	main := filepath.Join(dir, "main.asm")
+	ioutil.WriteFile(main, []byte("CALL draw\nEXIT\ninclude \"lib/draw.asm\"\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "lib", "draw.asm"), []byte("draw: CLS\nRET\n"), 0644)
+
+	p, err := AssembleFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x22, 0x04, 0x00, 0xFD, 0x00, 0xE0, 0x00, 0xEE}
+	if !bytes.Equal(p.Bytes, expected) {
+		t.Errorf("program should be % X, actual: % X\n", expected, p.Bytes)
+	}
+
+	if line := p.Lines[0x206]; line.File != filepath.Join(dir, "lib", "draw.asm") || line.Line != 2 {
+		t.Errorf("0x206 should map to lib/draw.asm:2, actual: %s\n", line)
+	}
+
+	ioutil.WriteFile(main, []byte("include \"main.asm\"\n"), 0644)
+	if _, err := AssembleFile(main); err == nil {
+		t.Errorf("include cycle should fail")
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tc := []struct {
+		src  string
+		line int
+	}{
+		{"CLS\nFOO V1", 2},
+		{"JP nowhere", 1},
+		{"LD V0, 0x100", 1},
+		{"DRW V0, V1, 16", 1},
+		{"a: CLS\na: CLS", 2},
+		{"CLS\nc = c + 1", 2},
+		{"SE 0x01, V1", 1},
+		{"V1 = 2", 1},
+		{"CLS V0", 1},
+	}
+
+	for _, c := range tc {
+		_, err := Assemble("test.asm", []byte(c.src))
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q should fail with an *Error, actual: %v\n", c.src, err)
+			continue
+		}
+
+		if e.Line.Line != c.line {
+			t.Errorf("%q should fail on line %d, actual: %s\n", c.src, c.line, e)
+		}
+	}
+}
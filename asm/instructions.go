@@ -0,0 +1,383 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keywords are the operands which aren't registers nor expressions.
+var keywords = map[string]bool{
+	"I": true, "[I]": true, "DT": true, "ST": true, "K": true, "F": true, "HF": true, "B": true, "R": true, "LONG": true,
+}
+
+// implicit are the instructions without operands.
+var implicit = map[string]rune{
+	"CLS":   0x00E0,
+	"RET":   0x00EE,
+	"SCR":   0x00FB,
+	"SCL":   0x00FC,
+	"EXIT":  0x00FD,
+	"LOW":   0x00FE,
+	"HIGH":  0x00FF,
+	"AUDIO": 0xF002,
+}
+
+// arithmetic are the 8xyn instructions, n being the value.
+var arithmetic = map[string]rune{
+	"OR":   0x1,
+	"AND":  0x2,
+	"XOR":  0x3,
+	"SUB":  0x5,
+	"SHR":  0x6,
+	"SUBN": 0x7,
+	"SHL":  0xE,
+}
+
+// loads are the Fxkk forms of LD, kk being the value. The register is the second operand when the keyword is the first one.
+var loads = map[string]rune{
+	"DT,":  0x15,
+	"ST,":  0x18,
+	"F,":   0x29,
+	"HF,":  0x30,
+	"B,":   0x33,
+	"[I],": 0x55,
+	"R,":   0x75,
+	",DT":  0x07,
+	",K":   0x0A,
+	",[I]": 0x65,
+	",R":   0x85,
+}
+
+// size returns the number of bytes of a statement, known before the symbols are.
+func size(mnemonic string, operands []string) int {
+	switch mnemonic {
+	case "DB":
+		return len(operands)
+	case "DW":
+		return 2 * len(operands)
+	case "LD":
+		if len(operands) == 2 {
+			if _, ok := longOperand(operands[1]); ok {
+				return 4
+			}
+		}
+	}
+
+	return 2
+}
+
+// longOperand returns the address of an operand "LONG addr". The keyword must be followed by a space, so that the symbols
+// starting with long are not mistaken for it.
+func longOperand(op string) (string, bool) {
+	fields := strings.Fields(op)
+	if len(fields) < 2 || strings.ToUpper(fields[0]) != "LONG" {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimSpace(op)[len(fields[0]):]), true
+}
+
+func isRegister(op string) bool {
+	_, ok := register(op)
+	return ok
+}
+
+func register(op string) (rune, bool) {
+	if len(op) != 2 || (op[0] != 'V' && op[0] != 'v') {
+		return 0, false
+	}
+
+	c := op[1]
+	switch {
+	case c >= '0' && c <= '9':
+		return rune(c - '0'), true
+	case c >= 'a' && c <= 'f':
+		return rune(c-'a') + 10, true
+	case c >= 'A' && c <= 'F':
+		return rune(c-'A') + 10, true
+	}
+
+	return 0, false
+}
+
+// registerRange parses "Vx - Vy".
+func registerRange(op string) (rune, rune, bool) {
+	parts := strings.Split(op, "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	x, ok := register(strings.TrimSpace(parts[0]))
+	if !ok {
+		return 0, 0, false
+	}
+
+	y, ok := register(strings.TrimSpace(parts[1]))
+	return x, y, ok
+}
+
+func word(w rune) []byte {
+	return []byte{byte(w >> 8), byte(w)}
+}
+
+// value evaluates an operand and checks it fits in max.
+func (a *assembler) value(op string, max int) (rune, error) {
+	v, err := a.eval(op, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if v < 0 || v > max {
+		return 0, fmt.Errorf("%s = %d out of range 0 to %d", op, v, max)
+	}
+
+	return rune(v), nil
+}
+
+// encode is the second pass, which turns a statement into bytes.
+func (a *assembler) encode(s *statement) ([]byte, error) {
+	ops := s.operands
+	arity := func(n int) error {
+		if len(ops) != n {
+			return fmt.Errorf("%s expects %d operands, got %d", s.mnemonic, n, len(ops))
+		}
+		return nil
+	}
+
+	// operand kinds: registers and keywords
+	reg := make([]rune, len(ops))
+	isReg := make([]bool, len(ops))
+	kw := make([]string, len(ops))
+	for i, op := range ops {
+		reg[i], isReg[i] = register(op)
+		if upper := strings.ToUpper(op); keywords[upper] {
+			kw[i] = upper
+		}
+	}
+
+	switch s.mnemonic {
+	case "DB":
+		b := make([]byte, len(ops))
+		for i, op := range ops {
+			v, err := a.value(op, 0xFF)
+			if err != nil {
+				return nil, err
+			}
+			b[i] = byte(v)
+		}
+		return b, nil
+
+	case "DW":
+		var b []byte
+		for _, op := range ops {
+			v, err := a.value(op, 0xFFFF)
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, word(v)...)
+		}
+		return b, nil
+
+	case "SCD", "SCU", "PLANE":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		n, err := a.value(ops[0], 0xF)
+		if err != nil {
+			return nil, err
+		}
+		switch s.mnemonic {
+		case "SCD":
+			return word(0x00C0 | n), nil
+		case "SCU":
+			return word(0x00D0 | n), nil
+		}
+		return word(0xF001 | n<<8), nil
+
+	case "JP", "CALL":
+		if len(ops) == 2 && s.mnemonic == "JP" {
+			if !isReg[0] || reg[0] != 0 {
+				return nil, fmt.Errorf("JP with 2 operands expects V0 first")
+			}
+			addr, err := a.value(ops[1], 0xFFF)
+			if err != nil {
+				return nil, err
+			}
+			return word(0xB000 | addr), nil
+		}
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		addr, err := a.value(ops[0], 0xFFF)
+		if err != nil {
+			return nil, err
+		}
+		if s.mnemonic == "JP" {
+			return word(0x1000 | addr), nil
+		}
+		return word(0x2000 | addr), nil
+
+	case "SE", "SNE":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if !isReg[0] {
+			return nil, fmt.Errorf("%s expects a register first", s.mnemonic)
+		}
+		if isReg[1] {
+			if s.mnemonic == "SE" {
+				return word(0x5000 | reg[0]<<8 | reg[1]<<4), nil
+			}
+			return word(0x9000 | reg[0]<<8 | reg[1]<<4), nil
+		}
+		kk, err := a.value(ops[1], 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		if s.mnemonic == "SE" {
+			return word(0x3000 | reg[0]<<8 | kk), nil
+		}
+		return word(0x4000 | reg[0]<<8 | kk), nil
+
+	case "LD":
+		return a.encodeLD(ops, reg, isReg, kw)
+
+	case "ADD":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		switch {
+		case kw[0] == "I" && isReg[1]:
+			return word(0xF01E | reg[1]<<8), nil
+		case isReg[0] && isReg[1]:
+			return word(0x8004 | reg[0]<<8 | reg[1]<<4), nil
+		case isReg[0]:
+			kk, err := a.value(ops[1], 0xFF)
+			if err != nil {
+				return nil, err
+			}
+			return word(0x7000 | reg[0]<<8 | kk), nil
+		}
+		return nil, fmt.Errorf("invalid operands for ADD")
+
+	case "OR", "AND", "XOR", "SUB", "SHR", "SUBN", "SHL":
+		// the shifts may omit Vy, which is then Vx so that the result doesn't depend on the ShiftVy quirk
+		if len(ops) == 1 && (s.mnemonic == "SHR" || s.mnemonic == "SHL") {
+			ops, reg, isReg = append(ops, ops[0]), append(reg, reg[0]), append(isReg, isReg[0])
+		}
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if !isReg[0] || !isReg[1] {
+			return nil, fmt.Errorf("%s expects 2 registers", s.mnemonic)
+		}
+		return word(0x8000 | reg[0]<<8 | reg[1]<<4 | arithmetic[s.mnemonic]), nil
+
+	case "RND":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if !isReg[0] {
+			return nil, fmt.Errorf("RND expects a register first")
+		}
+		kk, err := a.value(ops[1], 0xFF)
+		if err != nil {
+			return nil, err
+		}
+		return word(0xC000 | reg[0]<<8 | kk), nil
+
+	case "DRW":
+		if err := arity(3); err != nil {
+			return nil, err
+		}
+		if !isReg[0] || !isReg[1] {
+			return nil, fmt.Errorf("DRW expects 2 registers first")
+		}
+		n, err := a.value(ops[2], 0xF)
+		if err != nil {
+			return nil, err
+		}
+		return word(0xD000 | reg[0]<<8 | reg[1]<<4 | n), nil
+
+	case "SKP", "SKNP", "PITCH":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		if !isReg[0] {
+			return nil, fmt.Errorf("%s expects a register", s.mnemonic)
+		}
+		switch s.mnemonic {
+		case "SKP":
+			return word(0xE09E | reg[0]<<8), nil
+		case "SKNP":
+			return word(0xE0A1 | reg[0]<<8), nil
+		}
+		return word(0xF03A | reg[0]<<8), nil
+	}
+
+	if opcode, ok := implicit[s.mnemonic]; ok {
+		if err := arity(0); err != nil {
+			return nil, err
+		}
+		return word(opcode), nil
+	}
+
+	return nil, fmt.Errorf("unknown instruction %s", s.mnemonic)
+}
+
+func (a *assembler) encodeLD(ops []string, reg []rune, isReg []bool, kw []string) ([]byte, error) {
+	if len(ops) != 2 {
+		return nil, fmt.Errorf("LD expects 2 operands, got %d", len(ops))
+	}
+
+	if x, y, ok := registerRange(ops[1]); ok && kw[0] == "[I]" {
+		return word(0x5002 | x<<8 | y<<4), nil
+	}
+
+	if x, y, ok := registerRange(ops[0]); ok && kw[1] == "[I]" {
+		return word(0x5003 | x<<8 | y<<4), nil
+	}
+
+	if kw[0] == "I" {
+		if long, ok := longOperand(ops[1]); ok {
+			addr, err := a.value(long, 0xFFFF)
+			if err != nil {
+				return nil, err
+			}
+			return append(word(0xF000), word(addr)...), nil
+		}
+
+		addr, err := a.value(ops[1], 0xFFF)
+		if err != nil {
+			return nil, err
+		}
+		return word(0xA000 | addr), nil
+	}
+
+	if kw[0] != "" && isReg[1] {
+		if kk, ok := loads[kw[0]+","]; ok {
+			return word(0xF000 | reg[1]<<8 | kk), nil
+		}
+	}
+
+	if !isReg[0] {
+		return nil, fmt.Errorf("invalid operands for LD")
+	}
+
+	if kw[1] != "" {
+		if kk, ok := loads[","+kw[1]]; ok {
+			return word(0xF000 | reg[0]<<8 | kk), nil
+		}
+		return nil, fmt.Errorf("invalid operands for LD")
+	}
+
+	if isReg[1] {
+		return word(0x8000 | reg[0]<<8 | reg[1]<<4), nil
+	}
+
+	kk, err := a.value(ops[1], 0xFF)
+	if err != nil {
+		return nil, err
+	}
+	return word(0x6000 | reg[0]<<8 | kk), nil
+}
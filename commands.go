@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/asm"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/dap"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"github.com/jordanabderrachid/go-chip8/gdbstub"
+	"github.com/jordanabderrachid/go-chip8/monitor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commands are the subcommands, given as the first argument instead of running a ROM.
+var commands = map[string]func(args []string) error{
+	"asm":    asmCommand,
+	"dap":    dapCommand,
+	"debug":  debugCommand,
+	"disasm": disasmCommand,
+	"gdb":    gdbCommand,
+}
+
+// debugCommand loads a ROM in the interactive debugger.
+func debugCommand(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	speed := fs.Int("speed", cpu.DefaultCyclesPerFrame, "instructions executed per frame")
+	quirks := fs.String("quirks", "", "quirks profile: vip, chip48, schip or xochip")
+	seed := fs.Int64("seed", 0, seedUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-chip8 debug [-speed n] [-quirks profile] [-seed n] rom")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	b, err := readROM(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	c := &cpu.CPU{CyclesPerFrame: *speed, Seed: pickSeed(*seed)}
+	if *quirks != "" {
+		q, ok := cpu.QuirksProfiles[*quirks]
+		if !ok {
+			return fmt.Errorf("unknown quirks profile %q", *quirks)
+		}
+		c.Quirks = q
+	}
+
+	m, err := monitor.New(c, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if err := c.LoadData(b); err != nil {
+		return err
+	}
+
+	return m.Run()
+}
+
+// dapCommand runs a Debug Adapter Protocol server, on the standard input and output by default.
+func dapCommand(args []string) error {
+	fs := flag.NewFlagSet("dap", flag.ExitOnError)
+	addr := fs.String("addr", "", "TCP address to listen on instead of the standard input and output")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-chip8 dap [-addr host:port]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *addr != "" {
+		fmt.Fprintf(os.Stderr, "waiting for the editor on %s\n", *addr)
+		return dap.ListenAndServe(*addr)
+	}
+
+	return dap.Serve(os.Stdin, os.Stdout)
+}
+
+// gdbCommand loads a ROM and serves it to GDB on a TCP port.
+func gdbCommand(args []string) error {
+	fs := flag.NewFlagSet("gdb", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:1234", "TCP address to listen on")
+	speed := fs.Int("speed", cpu.DefaultCyclesPerFrame, "instructions executed per frame")
+	quirks := fs.String("quirks", "", "quirks profile: vip, chip48, schip or xochip")
+	seed := fs.Int64("seed", 0, seedUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-chip8 gdb [-addr host:port] [-speed n] [-quirks profile] [-seed n] rom")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	b, err := readROM(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	c := &cpu.CPU{CyclesPerFrame: *speed, Seed: pickSeed(*seed)}
+	if *quirks != "" {
+		q, ok := cpu.QuirksProfiles[*quirks]
+		if !ok {
+			return fmt.Errorf("unknown quirks profile %q", *quirks)
+		}
+		c.Quirks = q
+	}
+
+	if err := c.Reset(); err != nil {
+		return err
+	}
+
+	if err := c.LoadData(b); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "waiting for gdb on %s\n", *addr)
+	s := &gdbstub.Server{CPU: c}
+	return s.ListenAndServe(*addr)
+}
+
+// asmCommand assembles a source file into a ROM.
+func asmCommand(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ExitOnError)
+	out := fs.String("o", "", "ROM file to write, the source file with the .ch8 extension by default")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-chip8 asm [-o rom] source")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	p, err := asm.AssembleFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".ch8"
+	}
+
+	return ioutil.WriteFile(*out, p.Bytes, 0644)
+}
+
+// disasmCommand prints the address, the bytes and the mnemonic of each instruction of a ROM.
+func disasmCommand(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	follow := fs.Bool("follow", false, "follow the control flow from 0x200, the unreachable bytes are printed as data")
+	source := fs.Bool("source", false, "print the mnemonics as a source file for the asm command, the addresses as comments")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-chip8 disasm [-follow] [-source] rom")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	b, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	program := disasm.Disassemble(b, 0x200)
+	if *follow {
+		program = disasm.Follow(b, 0x200)
+	}
+
+	for _, in := range program {
+		if *source {
+			fmt.Printf("\t%-24s ; 0x%03X\n", in.Mnemonic, in.Addr)
+		} else {
+			fmt.Println(in)
+		}
+	}
+
+	return nil
+}
@@ -1,16 +1,20 @@
 package cpu
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/jordanabderrachid/go-chip8/display"
 	"github.com/jordanabderrachid/go-chip8/keyboard"
 	"github.com/jordanabderrachid/go-chip8/mmu"
+	"github.com/jordanabderrachid/go-chip8/spu"
 	"github.com/jordanabderrachid/go-chip8/timer"
-	"log"
-	"math/rand"
 	"time"
 )
 
+// DefaultCyclesPerFrame is the number of instructions executed on each tick of the 60Hz timers when CPU.CyclesPerFrame is not
+// set, about 600 instructions per second.
+const DefaultCyclesPerFrame = 10
+
 type Registers struct {
 	V [16]byte // The last byte VF is the flag register
 	I rune
@@ -22,6 +26,11 @@ type Registers struct {
 
 	DT byte // dhigelay timer
 	ST byte // sound timer
+
+	RPL [16]byte // SUPER-CHIP user flags, saved and restored by Fx75 and Fx85
+
+	Pattern [16]byte // XO-CHIP audio pattern buffer, loaded by F002
+	Pitch   byte     // XO-CHIP audio pitch, set by Fx3A
 }
 
 func (r *Registers) Reset() {
@@ -39,6 +48,23 @@ func (r *Registers) Reset() {
 
 	r.DT = 0x00
 	r.ST = 0x00
+
+	for i := range r.RPL {
+		r.RPL[i] = 0x00
+	}
+
+	r.Pattern = spu.SquareWave
+	r.Pitch = 64 // 4000Hz playback rate
+}
+
+func (r *Registers) String() string {
+	var b bytes.Buffer
+	for i, v := range r.V {
+		fmt.Fprintf(&b, "V%X=%02x ", i, v)
+	}
+	fmt.Fprintf(&b, "I=%04x PC=%04x SP=%02x DT=%02x ST=%02x", r.I, r.PC, r.SP, r.DT, r.ST)
+
+	return b.String()
 }
 
 type CPU struct {
@@ -47,85 +73,285 @@ type CPU struct {
 	SoundTimer, DelayTimer timer.Timer
 	Display                *display.Display
 	Keyboard               *keyboard.Keyboard
+	SPU                    *spu.SPU
+
+	Cycles         uint64 // number of instructions executed since the last reset
+	CyclesPerFrame int    // instructions executed on each tick of the timers, can be changed at any time
+	frameCycles    int    // instructions executed since the last tick of the timers
+	Exited         bool   // set by 00FD, no instruction is executed until the next reset
+
+	waitingKey bool // Fx0A saw a key press and waits for its release
+	waitedKey  byte
+
+	Renderer  display.Renderer // used by the display, nil runs without video output
+	AudioSink spu.Sink         // used by the SPU, nil runs without audio output
+	Input     keyboard.Source  // used by the keyboard, nil never presses any key
+	Quirks    Quirks
+
+	RNG  Random // draws the bytes of Cxkk, nil uses a XorShift
+	Seed int64  // seed given to the RNG on reset, the same seed and inputs always give the same run
+
+	Tracer Tracer // receives the trace of each instruction, nil disables the tracing, can be changed at any time
+
+	trace          Trace
+	traceRegisters Registers   // registers before the traced instruction
+	traceMemory    *mmu.Memory // memory on which the writes are traced
+
+	watches         []*watch
+	lastWatch       int
+	watchHits       []WatchHit // hits of the watchpoints pausing the execution, since the last Step
+	executing       bool       // ExecuteOpcode is running
+	executingPC     rune
+	executingOpcode rune
 }
 
-func (cpu *CPU) Reset() {
+// Reset powers the machine on again, keeping the backends, quirks, seed, tracer and watchpoints. It fails when the renderer
+// or the audio sink cannot be initialized.
+func (cpu *CPU) Reset() error {
 	cpu.Memory = new(mmu.Memory)
-	cpu.Keyboard = new(keyboard.Keyboard)
-	cpu.Display = new(display.Display)
+	cpu.Keyboard = &keyboard.Keyboard{Source: cpu.Input}
+	cpu.Display = &display.Display{Renderer: cpu.Renderer}
+	cpu.SPU = &spu.SPU{Sink: cpu.AudioSink}
 	cpu.R = new(Registers)
+	cpu.Cycles = 0
+	cpu.frameCycles = 0
+	cpu.Exited = false
+	cpu.waitingKey = false
+
+	if cpu.RNG == nil {
+		cpu.RNG = new(XorShift)
+	}
+	cpu.RNG.Seed(cpu.Seed)
 
 	cpu.R.Reset()
 	cpu.Memory.Reset()
-	cpu.Display.Reset()
+	if err := cpu.Display.Reset(); err != nil {
+		return err
+	}
+	if err := cpu.SPU.Reset(); err != nil {
+		return err
+	}
 	cpu.Keyboard.Reset()
 
 	if err := cpu.Memory.LoadSprites(); err != nil {
-		log.Panic(err)
+		return err
 	}
-}
 
-func (cpu *CPU) LoadData(b []byte) {
-	if err := cpu.Memory.AllocateWithBuffer(b, 0x200); err != nil {
-		log.Panic(err)
+	for _, wt := range cpu.watches {
+		cpu.install(wt)
 	}
+
+	return nil
 }
 
-func (cpu *CPU) GetOpcode(addr rune) (opcode rune) {
-	var high byte
-	var low byte
-	var err error
+func (cpu *CPU) LoadData(b []byte) error {
+	return cpu.Memory.AllocateWithBuffer(b, 0x200)
+}
+
+func (cpu *CPU) GetOpcode(addr rune) (rune, error) {
 	// instructions are stored as big-endian
-	high, err = cpu.Memory.GetByte(addr)
+	high, err := cpu.Memory.GetByte(addr)
 	if err != nil {
-		log.Panic(err)
+		return 0, &Error{Fault: MemoryFault, PC: addr, Err: err}
 	}
 
-	low, err = cpu.Memory.GetByte(addr + 1)
+	low, err := cpu.Memory.GetByte(addr + 1)
 	if err != nil {
-		log.Panic(err)
+		return 0, &Error{Fault: MemoryFault, PC: addr, Err: err}
 	}
 
-	log.Printf("running opcode %04x\n", rune(high)<<8+rune(low))
-	return rune(high)<<8 + rune(low)
+	return rune(high)<<8 + rune(low), nil
 }
 
-func (cpu *CPU) Run() {
+// Run executes one frame on each tick of the timers, until an instruction fails.
+func (cpu *CPU) Run() error {
 	ticker := time.NewTicker(time.Duration(int64(time.Second) / timer.Frenquency))
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			cpu.ExecuteOpcode(cpu.GetOpcode(cpu.R.PC))
-
-			if cpu.R.DT > 0x00 {
-				cpu.R.DT--
+			if _, err := cpu.RunFrame(); err != nil {
+				return err
 			}
+		}
+	}
+}
 
-			if cpu.R.ST > 0x00 {
-				cpu.R.ST--
-			}
+// StepResult describes the execution of one or more instructions.
+type StepResult struct {
+	Opcode        rune       // last executed opcode
+	PC            rune       // program counter before the first instruction
+	NextPC        rune       // program counter after the last instruction
+	Cycles        int        // number of executed instructions
+	ScreenChanged bool       // the framebuffer was drawn
+	Watch         []WatchHit // hits of the watchpoints without callback, which stopped the execution
+}
+
+// Step fetches, decodes and executes the instruction at PC. The timers are updated once every CyclesPerFrame instructions,
+// a failure of the audio sink is then returned after the instruction was executed. Once the program has exited, Step does
+// nothing.
+func (cpu *CPU) Step() (StepResult, error) {
+	res := StepResult{PC: cpu.R.PC, NextPC: cpu.R.PC}
+	if cpu.Exited {
+		return res, nil
+	}
+
+	gen := cpu.Display.Generation()
+
+	opcode, err := cpu.GetOpcode(cpu.R.PC)
+	if err != nil {
+		return res, err
+	}
+	res.Opcode = opcode
+
+	err = cpu.ExecuteOpcode(opcode)
+	res.Watch, cpu.watchHits = cpu.watchHits, nil
+	if err != nil {
+		return res, err
+	}
+
+	cpu.Cycles++
+	cpu.frameCycles++
+	if cpu.frameCycles >= cpu.Speed() {
+		cpu.frameCycles = 0
+		err = cpu.updateTimers()
+	}
+
+	res.NextPC = cpu.R.PC
+	res.Cycles = 1
+	res.ScreenChanged = cpu.Display.Generation() != gen
+	return res, err
+}
+
+// StepN executes n instructions as fast as possible, stopping at the first failing one, when the program exits or when a
+// watchpoint without callback is hit.
+func (cpu *CPU) StepN(n int) (StepResult, error) {
+	res := StepResult{PC: cpu.R.PC, NextPC: cpu.R.PC}
+	for i := 0; i < n; i++ {
+		r, err := cpu.Step()
+		res.Opcode = r.Opcode
+		res.NextPC = r.NextPC
+		res.Cycles += r.Cycles
+		res.ScreenChanged = res.ScreenChanged || r.ScreenChanged
+		res.Watch = append(res.Watch, r.Watch...)
+		if err != nil || cpu.Exited || len(r.Watch) > 0 {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// RunFrame executes instructions until the next update of the timers. A frame is one tick of the 60Hz timers. When the
+// speed was lowered during the frame, a single instruction ends it.
+func (cpu *CPU) RunFrame() (StepResult, error) {
+	n := cpu.Speed() - cpu.frameCycles
+	if n < 1 {
+		n = 1
+	}
+
+	return cpu.StepN(n)
+}
+
+// RunFrames executes n frames as fast as possible, stopping like StepN.
+func (cpu *CPU) RunFrames(n int) error {
+	for i := 0; i < n && !cpu.Exited; i++ {
+		res, err := cpu.RunFrame()
+		if err != nil {
+			return err
+		}
+
+		if len(res.Watch) > 0 {
+			return nil
 		}
 	}
+
+	return nil
+}
+
+// Speed returns the number of instructions executed per frame, CyclesPerFrame or DefaultCyclesPerFrame when it isn't set.
+func (cpu *CPU) Speed() int {
+	if cpu.CyclesPerFrame <= 0 {
+		return DefaultCyclesPerFrame
+	}
+
+	return cpu.CyclesPerFrame
 }
 
-func (cpu *CPU) ExecuteOpcode(opcode rune) {
+// updateTimers plays the sound of the frame, decrements the timers then reads the keyboard. The timers are updated even
+// when the audio sink fails, its error is returned afterwards.
+func (cpu *CPU) updateTimers() error {
+	err := cpu.SPU.Frame(cpu.R.ST > 0x00, cpu.R.Pattern, cpu.R.Pitch)
+
+	if cpu.R.DT > 0x00 {
+		cpu.R.DT--
+	}
+
+	if cpu.R.ST > 0x00 {
+		cpu.R.ST--
+	}
+
+	cpu.Keyboard.Update()
+	return err
+}
+
+// skip moves the program counter over the next instruction, which is 4 bytes long when it is F000 nnnn.
+func (cpu *CPU) skip() {
+	high, _ := cpu.Memory.GetByte(cpu.R.PC + 2)
+	low, _ := cpu.Memory.GetByte(cpu.R.PC + 3)
+	if high == 0xF0 && low == 0x00 {
+		cpu.R.PC += 6
+	} else {
+		cpu.R.PC += 4
+	}
+}
+
+// ExecuteOpcode executes a single instruction. A failing instruction returns an *Error.
+func (cpu *CPU) ExecuteOpcode(opcode rune) error {
+	var err error
+	pc := cpu.R.PC
+
+	if cpu.Tracer != nil {
+		cpu.beginTrace(pc, opcode)
+		defer cpu.endTrace()
+	}
+
+	cpu.executing, cpu.executingPC, cpu.executingOpcode = true, pc, opcode
+	defer func() { cpu.executing = false }()
+
 	switch opcode & 0xF000 {
 	case 0x0000: // 0x0xxx
-		switch opcode {
-		case 0x00E0: // 0x00E0
-			cpu.instr_00E0()
-		case 0x00EE: // 0x00EE
-			cpu.instr_00EE()
+		switch {
+		case opcode&0xFFF0 == 0x00C0: // 0x00Cn
+			n := byte(opcode & 0x000F)
+			err = cpu.instr_00Cn(n)
+		case opcode&0xFFF0 == 0x00D0: // 0x00Dn
+			n := byte(opcode & 0x000F)
+			err = cpu.instr_00Dn(n)
+		case opcode == 0x00E0: // 0x00E0
+			err = cpu.instr_00E0()
+		case opcode == 0x00EE: // 0x00EE
+			err = cpu.instr_00EE()
+		case opcode == 0x00FB: // 0x00FB
+			err = cpu.instr_00FB()
+		case opcode == 0x00FC: // 0x00FC
+			err = cpu.instr_00FC()
+		case opcode == 0x00FD: // 0x00FD
+			cpu.instr_00FD()
+		case opcode == 0x00FE: // 0x00FE
+			err = cpu.instr_00FE()
+		case opcode == 0x00FF: // 0x00FF
+			err = cpu.instr_00FF()
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	case 0x1000: // 0x1xxx
 		addr := opcode & 0x0FFF
 		cpu.instr_1nnn(addr)
 	case 0x2000: // 0x2xxx
 		addr := opcode & 0x0FFF
-		cpu.instr_2nnn(addr)
+		err = cpu.instr_2nnn(addr)
 	case 0x3000: // 0x3xxx
 		x := byte((opcode & 0x0F00) >> 8)
 		value := byte(opcode & 0x00FF)
@@ -140,8 +366,12 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		switch opcode & 0x000F {
 		case 0x0000: // 0x5xx0
 			cpu.instr_5xy0(x, y)
+		case 0x0002: // 0x5xx2
+			err = cpu.instr_5xy2(x, y)
+		case 0x0003: // 0x5xx3
+			err = cpu.instr_5xy3(x, y)
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	case 0x6000: // 0x6xxx
 		x := byte((opcode & 0x0F00) >> 8)
@@ -168,13 +398,13 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		case 0x0005: // 0x8xx5
 			cpu.instr_8xy5(x, y)
 		case 0x0006: // 0x8xx6
-			cpu.instr_8xy6(x)
+			cpu.instr_8xy6(x, y)
 		case 0x0007: // 0x8xx7
 			cpu.instr_8xy7(x, y)
 		case 0x000E: // 0x8xxE
-			cpu.instr_8xyE(x)
+			cpu.instr_8xyE(x, y)
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	case 0x9000: // 0x9xxx
 		x := byte((opcode & 0x0F00) >> 8)
@@ -183,7 +413,7 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		case 0x0000: // 0x9xx0
 			cpu.instr_9xy0(x, y)
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	case 0xA000: // 0xAxxx
 		addr := opcode & 0x0FFF
@@ -199,7 +429,7 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		x := byte((opcode & 0x0F00) >> 8)
 		y := byte((opcode & 0x00F0) >> 4)
 		n := byte(opcode & 0x000F)
-		cpu.instr_Dxyn(x, y, n)
+		err = cpu.instr_Dxyn(x, y, n)
 	case 0xE000: // 0xExxx
 		x := byte((opcode & 0x0F00) >> 8)
 		switch opcode & 0x00FF {
@@ -208,11 +438,25 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		case 0x00A1: // 0xExA1
 			cpu.instr_ExA1(x)
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	case 0xF000: // 0xF000
 		x := byte((opcode & 0x0F00) >> 8)
 		switch opcode & 0x00FF {
+		case 0x0000: // 0xFx00
+			if x != 0x0 {
+				err = fault(IllegalOpcode, nil)
+				break
+			}
+			err = cpu.instr_F000()
+		case 0x0001: // 0xFx01
+			cpu.instr_Fn01(x)
+		case 0x0002: // 0xFx02
+			if x != 0x0 {
+				err = fault(IllegalOpcode, nil)
+				break
+			}
+			err = cpu.instr_F002()
 		case 0x0007: // 0xFx07
 			cpu.instr_Fx07(x)
 		case 0x000A: // 0xFx0A
@@ -224,38 +468,136 @@ func (cpu *CPU) ExecuteOpcode(opcode rune) {
 		case 0x001E: // 0xFx1E
 			cpu.instr_Fx1E(x)
 		case 0x0029: // 0xFx29
-			cpu.instr_Fx29(x)
+			err = cpu.instr_Fx29(x)
+		case 0x0030: // 0xFx30
+			err = cpu.instr_Fx30(x)
 		case 0x0033: // 0xFx33
-			cpu.instr_Fx33(x)
+			err = cpu.instr_Fx33(x)
+		case 0x003A: // 0xFx3A
+			cpu.instr_Fx3A(x)
 		case 0x0055: // 0xFx55
-			cpu.instr_Fx55(x)
+			err = cpu.instr_Fx55(x)
 		case 0x0065: // 0xFx65
-			cpu.instr_Fx65(x)
+			err = cpu.instr_Fx65(x)
+		case 0x0075: // 0xFx75
+			cpu.instr_Fx75(x)
+		case 0x0085: // 0xFx85
+			cpu.instr_Fx85(x)
 		default:
-			log.Panic(fmt.Sprintf("Unknown opcode %04x", opcode))
+			err = fault(IllegalOpcode, nil)
 		}
 	}
+
+	if e, ok := err.(*Error); ok {
+		e.PC = pc
+		e.Opcode = opcode
+	}
+
+	return err
+}
+
+// 0x00Dn - SCU nibble
+// Scroll the display up by n lines (XO-CHIP).
+func (cpu *CPU) instr_00Dn(n byte) error {
+	if err := cpu.Display.ScrollUp(int(n)); err != nil {
+		return fault(DisplayFault, err)
+	}
+
+	cpu.R.PC += 2
+	return nil
 }
 
 // 0x00E0 - CLS
 // Clear the display.
 // Increment the PC.
-func (cpu *CPU) instr_00E0() {
-	log.Println("clear display")
-	cpu.Display.Clear()
+func (cpu *CPU) instr_00E0() error {
+	if err := cpu.Display.Clear(); err != nil {
+		return fault(DisplayFault, err)
+	}
+
 	cpu.R.PC += 2
+	return nil
 }
 
 // 0x00EE - RET
 // Return from a subroutine.
 //
 // The interpreter sets the program counter to the address at the top of the stack, then substracts 1 from the stack pointer.
-func (cpu *CPU) instr_00EE() {
+func (cpu *CPU) instr_00EE() error {
+	if cpu.R.SP == 0x00 {
+		return fault(StackUnderflow, nil)
+	}
+
 	cpu.R.PC = cpu.R.Stack[cpu.R.SP]
-	log.Printf("return from subroutine, PC is now %04x\n", cpu.R.PC)
-	if cpu.R.SP > 0x00 {
-		cpu.R.SP--
+	cpu.R.SP--
+	return nil
+}
+
+// 0x00Cn - SCD nibble
+// Scroll the display down by n lines (SUPER-CHIP).
+func (cpu *CPU) instr_00Cn(n byte) error {
+	if err := cpu.Display.ScrollDown(int(n)); err != nil {
+		return fault(DisplayFault, err)
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0x00FB - SCR
+// Scroll the display right by 4 pixels (SUPER-CHIP).
+func (cpu *CPU) instr_00FB() error {
+	if err := cpu.Display.ScrollRight(4); err != nil {
+		return fault(DisplayFault, err)
 	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0x00FC - SCL
+// Scroll the display left by 4 pixels (SUPER-CHIP).
+func (cpu *CPU) instr_00FC() error {
+	if err := cpu.Display.ScrollLeft(4); err != nil {
+		return fault(DisplayFault, err)
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0x00FD - EXIT
+// Exit the interpreter (SUPER-CHIP).
+//
+// The program counter is left on the instruction and no other instruction is executed until the CPU is reset.
+func (cpu *CPU) instr_00FD() {
+	cpu.Exited = true
+}
+
+// 0x00FE - LOW
+// Disable the high resolution mode (SUPER-CHIP).
+//
+// The display is switched to 64x32 and cleared.
+func (cpu *CPU) instr_00FE() error {
+	if err := cpu.Display.SetHighRes(false); err != nil {
+		return fault(DisplayFault, err)
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0x00FF - HIGH
+// Enable the high resolution mode (SUPER-CHIP).
+//
+// The display is switched to 128x64 and cleared.
+func (cpu *CPU) instr_00FF() error {
+	if err := cpu.Display.SetHighRes(true); err != nil {
+		return fault(DisplayFault, err)
+	}
+
+	cpu.R.PC += 2
+	return nil
 }
 
 // 0x1nnn - JP addr
@@ -263,7 +605,6 @@ func (cpu *CPU) instr_00EE() {
 //
 // The interpreter sets the program counter to nnn.
 func (cpu *CPU) instr_1nnn(addr rune) {
-	log.Printf("jump to location %04x\n", addr)
 	cpu.R.PC = addr
 }
 
@@ -271,24 +612,26 @@ func (cpu *CPU) instr_1nnn(addr rune) {
 // Call subroutine at nnn.
 //
 // The interpreter increments the stack pointer, then puts the current PC on the top of the stack. The PC is then set to nnn.
-func (cpu *CPU) instr_2nnn(addr rune) {
-	log.Printf("call subroutine at %04x\n", addr)
+func (cpu *CPU) instr_2nnn(addr rune) error {
+	if int(cpu.R.SP) >= len(cpu.R.Stack)-1 {
+		return fault(StackOverflow, nil)
+	}
+
 	cpu.R.SP++
 	cpu.R.Stack[cpu.R.SP] = cpu.R.PC + 2
 	cpu.R.PC = addr
+	return nil
 }
 
 // 0x3xkk - SE Vx, byte
 // Skip next instruction if Vx == kk.
 //
-// The interpreter compares register Vx to kk, and if they are equal, increments the program counter by 4, else increments by 2.
+// The interpreter compares register Vx to kk, and if they are equal, skips the next instruction, else increments the program
+// counter by 2.
 func (cpu *CPU) instr_3xkk(x, value byte) {
-	log.Printf("skip instruction if V[%x] == %02x\n", x, value)
 	if cpu.R.V[x] == value {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+		cpu.skip()
 	} else {
-		log.Println("instruction not skipped")
 		cpu.R.PC += 2
 	}
 }
@@ -296,14 +639,12 @@ func (cpu *CPU) instr_3xkk(x, value byte) {
 // 0x4xkk - SNE Vx, byte
 // Skip next instruction if Vx != kk.
 //
-// The interpreter compares register Vx to kk, and if they are not equal, increments the program counter by 4, else increments by 2.
+// The interpreter compares register Vx to kk, and if they are not equal, skips the next instruction, else increments the program
+// counter by 2.
 func (cpu *CPU) instr_4xkk(x, value byte) {
-	log.Printf("skip instruction if V[%x] != %02x\n", x, value)
 	if cpu.R.V[x] != value {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+		cpu.skip()
 	} else {
-		log.Println("instruction not skipped")
 		cpu.R.PC += 2
 	}
 }
@@ -311,24 +652,69 @@ func (cpu *CPU) instr_4xkk(x, value byte) {
 // 0x5xy0 - SE Vx, Vy
 // Skip next instruction if Vx == Vy.
 //
-// The interpreter compares register Vx to register Vy, and if they are equal, increments the program counter by 4, else increments by 2.
+// The interpreter compares register Vx to register Vy, and if they are equal, skips the next instruction, else increments the
+// program counter by 2.
 func (cpu *CPU) instr_5xy0(x, y byte) {
-	log.Printf("skip next instruction if V[%x] == V[%x]\n", x, y)
 	if cpu.R.V[x] == cpu.R.V[y] {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+		cpu.skip()
 	} else {
-		log.Println("instruction not skipped")
 		cpu.R.PC += 2
 	}
 }
 
+// 0x5xy2 - LD [I], Vx - Vy
+// Store registers Vx through Vy in memory starting at location I (XO-CHIP).
+//
+// The registers are stored in descending order when x > y. I is left unchanged.
+func (cpu *CPU) instr_5xy2(x, y byte) error {
+	for i, r := range registerRange(x, y) {
+		if err := cpu.Memory.SetByte(cpu.R.I+rune(i), cpu.R.V[r]); err != nil {
+			return fault(MemoryFault, err)
+		}
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0x5xy3 - LD Vx - Vy, [I]
+// Read registers Vx through Vy from memory starting at location I (XO-CHIP).
+//
+// The registers are read in descending order when x > y. I is left unchanged.
+func (cpu *CPU) instr_5xy3(x, y byte) error {
+	for i, r := range registerRange(x, y) {
+		b, err := cpu.Memory.GetByte(cpu.R.I + rune(i))
+		if err != nil {
+			return fault(MemoryFault, err)
+		}
+		cpu.R.V[r] = b
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// registerRange returns the registers from x to y included, in descending order when x > y.
+func registerRange(x, y byte) []byte {
+	var r []byte
+	if x <= y {
+		for i := x; i <= y; i++ {
+			r = append(r, i)
+		}
+	} else {
+		for i := int(x); i >= int(y); i-- {
+			r = append(r, byte(i))
+		}
+	}
+
+	return r
+}
+
 // 0x6xkk - LD Vx, byte
 // Set Vx = kk.
 //
 // The interpreter puts the value kk into register Vx.
 func (cpu *CPU) instr_6xkk(x, value byte) {
-	log.Printf("set V[%x] = %02x\n", x, value)
 	cpu.R.V[x] = value
 	cpu.R.PC += 2
 }
@@ -338,7 +724,6 @@ func (cpu *CPU) instr_6xkk(x, value byte) {
 //
 // Adds the value kk to the value of register Vx, then stores the result in Vx.
 func (cpu *CPU) instr_7xkk(x, value byte) {
-	log.Printf("add %02x to V[%x]\n", value, x)
 	cpu.R.V[x] += value
 	cpu.R.PC += 2
 }
@@ -348,7 +733,6 @@ func (cpu *CPU) instr_7xkk(x, value byte) {
 //
 // Stores the value of the register Vy in register Vx.
 func (cpu *CPU) instr_8xy0(x, y byte) {
-	log.Printf("set V[%x] = V[%x]\n", x, y)
 	cpu.R.V[x] = cpu.R.V[y]
 	cpu.R.PC += 2
 }
@@ -356,30 +740,37 @@ func (cpu *CPU) instr_8xy0(x, y byte) {
 // 0x8xy1 - OR Vx, Vy
 // Set Vx = Vx OR Vy.
 //
-// Performs a bitwise OR on the values of Vx and Vy, then stores the result in Vx.
+// Performs a bitwise OR on the values of Vx and Vy, then stores the result in Vx. With the ResetVF quirk, VF is set to 0.
 func (cpu *CPU) instr_8xy1(x, y byte) {
-	log.Printf("set V[%x] = V[%x] OR V[%x]\n", x, x, y)
 	cpu.R.V[x] = cpu.R.V[x] | cpu.R.V[y]
+	if cpu.Quirks.ResetVF {
+		cpu.R.V[0xF] = 0
+	}
 	cpu.R.PC += 2
 }
 
 // 0x8xy2 - AND Vx, Vy
 // Set Vx = Vx AND Vy.
 //
-// Performs a bitwise AND on the values of Vx and Vy, then stores the result in Vx.
+// Performs a bitwise AND on the values of Vx and Vy, then stores the result in Vx. With the ResetVF quirk, VF is set to 0.
 func (cpu *CPU) instr_8xy2(x, y byte) {
-	log.Printf("set V[%x] = V[%x] AND V[%x]\n", x, x, y)
 	cpu.R.V[x] = cpu.R.V[x] & cpu.R.V[y]
+	if cpu.Quirks.ResetVF {
+		cpu.R.V[0xF] = 0
+	}
 	cpu.R.PC += 2
 }
 
 // 0x8xy3 - XOR Vx, Vy
 // Set Vx = Vx XOR Vy.
 //
-// Performs a bitwise exclusive OR on the values of Vx and Vy, then stores the result in Vx.
+// Performs a bitwise exclusive OR on the values of Vx and Vy, then stores the result in Vx. With the ResetVF quirk, VF is set
+// to 0.
 func (cpu *CPU) instr_8xy3(x, y byte) {
-	log.Printf("set V[%x] = V[%x] XOR V[%x]\n", x, x, y)
 	cpu.R.V[x] = cpu.R.V[x] ^ cpu.R.V[y]
+	if cpu.Quirks.ResetVF {
+		cpu.R.V[0xF] = 0
+	}
 	cpu.R.PC += 2
 }
 
@@ -389,36 +780,31 @@ func (cpu *CPU) instr_8xy3(x, y byte) {
 // The values of Vx and Vy are added together. If the result is greater than 8bits (>255), VF is set to 1, otherwise 0.
 // Only the lowest 8 bits of the result are kept, and stored in Vx.
 func (cpu *CPU) instr_8xy4(x, y byte) {
-	log.Printf("set V[%x] = V[%x] + V[%x]\n", x, x, y)
-	result := rune(cpu.R.V[x] + cpu.R.V[y])
+	result := rune(cpu.R.V[x]) + rune(cpu.R.V[y])
 
+	cpu.R.V[x] = byte(result & 0xFF)
 	if result > 0xFF {
-		log.Println("set V[F] = 1")
 		cpu.R.V[0xF] = 1
 	} else {
-		log.Println("set V[F] = 0")
 		cpu.R.V[0xF] = 0
 	}
 
-	cpu.R.V[x] = byte(result & 0xFF)
 	cpu.R.PC += 2
 }
 
 // 0x8xy5 - SUB Vx, Vy
 // Set Vx = Vx - Vy, set VF = NOT borrow.
 //
-// If Vx > Vy, then VF is set to 1, otherwise 0. The Vy is subtracted from Vx, and the result is stored in Vx.
+// If Vx >= Vy, then VF is set to 1, otherwise 0. The Vy is subtracted from Vx, and the result is stored in Vx.
+// VF is written after the result, so the flag wins when x is F.
 func (cpu *CPU) instr_8xy5(x, y byte) {
-	log.Printf("set V[%x] = V[%x] + V[%x]\n", x, x, y)
-	if cpu.R.V[x] > cpu.R.V[y] {
-		cpu.R.V[0xF] = 1
-		log.Println("set V[F] = 1")
-	} else {
-		log.Println("set V[F] = 0")
-		cpu.R.V[0xF] = 0
+	flag := byte(0)
+	if cpu.R.V[x] >= cpu.R.V[y] {
+		flag = 1
 	}
 
 	cpu.R.V[x] -= cpu.R.V[y]
+	cpu.R.V[0xF] = flag
 	cpu.R.PC += 2
 }
 
@@ -426,28 +812,32 @@ func (cpu *CPU) instr_8xy5(x, y byte) {
 // Set Vx = Vx SHR 1.
 //
 // If the least-significant bit of Vx is 1, then VF is set to 1, otherwise 0. Then Vx is divided by 2.
-func (cpu *CPU) instr_8xy6(x byte) {
-	log.Printf("set V[%x] = V[%x] SHR 1\n", x, x)
-	cpu.R.V[0xF] = cpu.R.V[x] & 0x1
-	cpu.R.V[x] /= 2
+// With the ShiftVy quirk, Vy is shifted instead of Vx and the result is stored in Vx.
+func (cpu *CPU) instr_8xy6(x, y byte) {
+	src := x
+	if cpu.Quirks.ShiftVy {
+		src = y
+	}
+
+	flag := cpu.R.V[src] & 0x01
+	cpu.R.V[x] = cpu.R.V[src] >> 1
+	cpu.R.V[0xF] = flag
 	cpu.R.PC += 2
 }
 
 // 0x8xy7 - SUBN Vx, Vy
 // Set Vx = Vy - Vx, set VF = NOT borrow.
 //
-// If Vy > Vx, then VF is set to 1, otherwise 0. Then Vx is subtracted from Vy, and the result is stored in Vx.
+// If Vy >= Vx, then VF is set to 1, otherwise 0. Then Vx is subtracted from Vy, and the result is stored in Vx.
+// VF is written after the result, so the flag wins when x is F.
 func (cpu *CPU) instr_8xy7(x, y byte) {
-	log.Printf("set V[%x] = V[%x] - V[%x]\n", x, y, x)
-	if cpu.R.V[y] > cpu.R.V[x] {
-		log.Println("set V[F] = 1")
-		cpu.R.V[0xF] = 1
-	} else {
-		log.Println("set V[F] = 0")
-		cpu.R.V[0xF] = 0
+	flag := byte(0)
+	if cpu.R.V[y] >= cpu.R.V[x] {
+		flag = 1
 	}
 
 	cpu.R.V[x] = cpu.R.V[y] - cpu.R.V[x]
+	cpu.R.V[0xF] = flag
 	cpu.R.PC += 2
 }
 
@@ -455,24 +845,28 @@ func (cpu *CPU) instr_8xy7(x, y byte) {
 // Set Vx = Vx SHL 1.
 //
 // If the most-significant bit of Vx is 1, then VF is set to 1, otherwise 0. Then Vx is multiplied by 2.
-func (cpu *CPU) instr_8xyE(x byte) {
-	log.Printf("set V[%x] = V[%x] SHL 1\n", x, x)
-	cpu.R.V[0xF] = cpu.R.V[x] & 0x80
-	cpu.R.V[x] *= 2
+// With the ShiftVy quirk, Vy is shifted instead of Vx and the result is stored in Vx.
+func (cpu *CPU) instr_8xyE(x, y byte) {
+	src := x
+	if cpu.Quirks.ShiftVy {
+		src = y
+	}
+
+	flag := cpu.R.V[src] >> 7
+	cpu.R.V[x] = cpu.R.V[src] << 1
+	cpu.R.V[0xF] = flag
 	cpu.R.PC += 2
 }
 
 // 0x9xy0 - SNE Vx, Vy
 // Skip next instruction if Vx != Vy.
 //
-// The values of Vx and Vy are compared, and if they are not equal, the program counter is increased by 4, otherwise by 2.
+// The values of Vx and Vy are compared, and if they are not equal, the next instruction is skipped, otherwise the program counter
+// is increased by 2.
 func (cpu *CPU) instr_9xy0(x, y byte) {
-	log.Printf("skip next instruction if V[%x] != V[%x]\n", x, y)
 	if cpu.R.V[x] != cpu.R.V[y] {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+		cpu.skip()
 	} else {
-		log.Println("instruction not skipped")
 		cpu.R.PC += 2
 	}
 }
@@ -482,7 +876,6 @@ func (cpu *CPU) instr_9xy0(x, y byte) {
 //
 // The value of register I is set to nnn.
 func (cpu *CPU) instr_Annn(addr rune) {
-	log.Printf("set I = %04x\n", addr)
 	cpu.R.I = addr
 	cpu.R.PC += 2
 }
@@ -491,9 +884,14 @@ func (cpu *CPU) instr_Annn(addr rune) {
 // Jump to location nnn + V0.
 //
 // The program counter is set to nnn plus the value of V0.
+// With the JumpVx quirk, the register added is Vx, x being the highest nibble of nnn.
 func (cpu *CPU) instr_Bnnn(addr rune) {
-	log.Printf("jump to V[0] + %04x = %04x", addr, rune(cpu.R.V[0x0])+addr)
-	cpu.R.PC = rune(cpu.R.V[0x0]) + addr
+	var x byte
+	if cpu.Quirks.JumpVx {
+		x = byte(addr >> 8)
+	}
+
+	cpu.R.PC = rune(cpu.R.V[x]) + addr
 }
 
 // 0xCxkk - RND Vx, byte
@@ -501,9 +899,7 @@ func (cpu *CPU) instr_Bnnn(addr rune) {
 //
 // The interpreter generates a random number from 0 to 255, which is then ANDed with the value kk. The results are stored in Vx.
 func (cpu *CPU) instr_Cxkk(x, value byte) {
-	log.Printf("set V[%x] = random byte AND %02x\n", x, value)
-	random := byte(rand.Intn(0xFF + 1)) // Intn exclude the last value.
-	cpu.R.V[x] = random & value
+	cpu.R.V[x] = cpu.RNG.Byte() & value
 	cpu.R.PC += 2
 }
 
@@ -513,49 +909,55 @@ func (cpu *CPU) instr_Cxkk(x, value byte) {
 // The interpreter reads n bytes from memory, starting at the address stored in I. These bytes are the displayed as sprites on screen
 // coordinates (Vx, Vy). Sprites are XORed onto the existing screen. If this causes any pixel to be erased, VF is set to 1, otherwise
 // it is set to 0. If the sprite is positioned so part of it is outside the coordinates of the display, it wraps around to the
-// opposite side of the screen.
-func (cpu *CPU) instr_Dxyn(x, y, n byte) {
-	log.Printf("display %x-byte sprite starting at memory location %04x at (%02x, %02x)", n, cpu.R.I, cpu.R.V[x], cpu.R.V[y])
-	cells := make([]byte, n)
-	for i := 0; i < int(n); i++ {
+// opposite side of the screen, or is clipped with the ClipSprites quirk.
+//
+// With n = 0, a 16x16 sprite made of 32 bytes is drawn instead (SUPER-CHIP), or an 8x16 sprite made of 16 bytes in low
+// resolution with the TallSprites quirk. When several planes are selected, the data of each plane follow each other in
+// memory (XO-CHIP).
+func (cpu *CPU) instr_Dxyn(x, y, n byte) error {
+	size, width := int(n), 8
+	if n == 0 && cpu.Quirks.TallSprites && !cpu.Display.HighRes {
+		size = 16
+	} else if n == 0 {
+		size, width = 32, 16
+	}
+	size *= cpu.Display.Planes()
+
+	cells := make([]byte, size)
+	for i := 0; i < size; i++ {
 		b, err := cpu.Memory.GetByte(cpu.R.I + rune(i))
 		if err != nil {
-			log.Panic(err)
+			return fault(MemoryFault, err)
 		}
 		cells[i] = b
 	}
 
-	sprite := display.Sprite{cells}
-	coll, err := cpu.Display.DrawSprite(int(cpu.R.V[x]), int(cpu.R.V[y]), sprite)
+	sprite := display.Sprite{Cells: cells, Width: width}
+	coll, err := cpu.Display.DrawSprite(int(cpu.R.V[x]), int(cpu.R.V[y]), sprite, cpu.Quirks.ClipSprites)
 	if err != nil {
-		log.Panic(err)
+		return fault(DisplayFault, err)
 	}
 
 	if coll {
-		log.Println("collision")
 		cpu.R.V[0xF] = 1
 	} else {
-		log.Println("no collision")
 		cpu.R.V[0xF] = 0
 	}
 
 	cpu.R.PC += 2
+	return nil
 }
 
 // 0xEx9E - SKP Vx
 // Skip next instruction if key with the value of Vx is pressed.
 //
-// Checks the keyboard, and if the key corresponding to the value of Vx is currently in the down position, PC is increased by 4,
-// otherwise by 2.
+// Checks the keyboard, and if the key corresponding to the value of Vx is currently in the down position, the next
+// instruction is skipped, otherwise PC is increased by 2.
 func (cpu *CPU) instr_Ex9E(x byte) {
-	log.Printf("skip net instruction if key %x is pressed\n", cpu.R.V[x])
 	b := cpu.R.V[x]
-	// TODO: check keyboard state
-	if keyboard.IsKeyPressed(b) {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+	if cpu.Keyboard.KeyState[b] {
+		cpu.skip()
 	} else {
-		log.Println("instruction not skipped")
 		cpu.R.PC += 2
 	}
 }
@@ -563,19 +965,61 @@ func (cpu *CPU) instr_Ex9E(x byte) {
 // 0xExA1 - SKNP Vx
 // Skip next instruction if key with the value of Vx is not pressed.
 //
-// Checks the keyboard, and if the key corresponding to the value of Vx is currently in the up position, PC is increased by 4,
-// otherwise by 2.
+// Checks the keyboard, and if the key corresponding to the value of Vx is currently in the up position, the next
+// instruction is skipped, otherwise PC is increased by 2.
 func (cpu *CPU) instr_ExA1(x byte) {
-	log.Printf("skip net instruction if key %x is not pressed\n", cpu.R.V[x])
 	b := cpu.R.V[x]
-	// TODO: check keyboard state
-	if keyboard.IsKeyPressed(b) {
-		log.Println("instruction not skipped")
+	if cpu.Keyboard.KeyState[b] {
 		cpu.R.PC += 2
 	} else {
-		log.Println("instruction skipped")
-		cpu.R.PC += 4
+		cpu.skip()
+	}
+}
+
+// 0xF000 nnnn - LD I, LONG addr
+// Set I = nnnn (XO-CHIP).
+//
+// The 16 bits address is read from the 2 bytes following the instruction, the program counter is then increased by 4.
+func (cpu *CPU) instr_F000() error {
+	high, err := cpu.Memory.GetByte(cpu.R.PC + 2)
+	if err != nil {
+		return fault(MemoryFault, err)
+	}
+
+	low, err := cpu.Memory.GetByte(cpu.R.PC + 3)
+	if err != nil {
+		return fault(MemoryFault, err)
 	}
+
+	cpu.R.I = rune(high)<<8 + rune(low)
+	cpu.R.PC += 4
+	return nil
+}
+
+// 0xFn01 - PLANE n
+// Select the drawing planes n (XO-CHIP).
+//
+// The following clear, draw and scroll instructions only affect the planes whose bit is set in n.
+func (cpu *CPU) instr_Fn01(n byte) {
+	cpu.Display.Plane = n & 0x03
+	cpu.R.PC += 2
+}
+
+// 0xF002 - AUDIO
+// Load the audio pattern buffer from memory starting at location I (XO-CHIP).
+//
+// The 16 bytes starting at I are copied into the pattern buffer played while the sound timer is active.
+func (cpu *CPU) instr_F002() error {
+	for i := range cpu.R.Pattern {
+		b, err := cpu.Memory.GetByte(cpu.R.I + rune(i))
+		if err != nil {
+			return fault(MemoryFault, err)
+		}
+		cpu.R.Pattern[i] = b
+	}
+
+	cpu.R.PC += 2
+	return nil
 }
 
 // 0xFx07 - LD Vx, DT
@@ -583,7 +1027,6 @@ func (cpu *CPU) instr_ExA1(x byte) {
 //
 // The value of DT is placed into Vx.
 func (cpu *CPU) instr_Fx07(x byte) {
-	log.Printf("set V[%x] = delay timer value (%02x)\n", x, cpu.R.DT)
 	cpu.R.V[x] = cpu.R.DT
 	cpu.R.PC += 2
 }
@@ -592,9 +1035,29 @@ func (cpu *CPU) instr_Fx07(x byte) {
 // Wait for a key press, store the value of the key in Vx.
 //
 // All execution stops until a key is pressed, then the value of that key is stored in Vx.
+//
+// The program counter is left on the instruction until it completes, so the timers keep running meanwhile. As on the COSMAC
+// VIP, the key is stored once it is released, or as soon as it is pressed with the WaitKeyOnPress quirk.
 func (cpu *CPU) instr_Fx0A(x byte) {
-	log.Println("freeze until key press")
-	cpu.R.V[x] = 0x01
+	if !cpu.waitingKey {
+		k, ok := cpu.Keyboard.JustPressed()
+		if !ok {
+			return
+		}
+
+		// the press is only seen once per frame, another Fx0A of the same frame must wait for the next one
+		cpu.Keyboard.Consume(k)
+		cpu.waitingKey = true
+		cpu.waitedKey = k
+		if !cpu.Quirks.WaitKeyOnPress {
+			return
+		}
+	} else if !cpu.Keyboard.JustReleased(cpu.waitedKey) {
+		return
+	}
+
+	cpu.waitingKey = false
+	cpu.R.V[x] = cpu.waitedKey
 	cpu.R.PC += 2
 }
 
@@ -603,7 +1066,6 @@ func (cpu *CPU) instr_Fx0A(x byte) {
 //
 // DT is set equal to the value of Vx.
 func (cpu *CPU) instr_Fx15(x byte) {
-	log.Printf("set DT = V[%x] (%02x)\n", x, cpu.R.V[x])
 	cpu.R.DT = cpu.R.V[x]
 	cpu.R.PC += 2
 }
@@ -613,7 +1075,6 @@ func (cpu *CPU) instr_Fx15(x byte) {
 //
 // ST is set equal to the value of Vx.
 func (cpu *CPU) instr_Fx18(x byte) {
-	log.Printf("set ST = V[%x] (%02x)\n", x, cpu.R.V[x])
 	cpu.R.ST = cpu.R.V[x]
 	cpu.R.PC += 2
 }
@@ -623,7 +1084,6 @@ func (cpu *CPU) instr_Fx18(x byte) {
 //
 // The values of I and Vx are added, and the results are stored in I.
 func (cpu *CPU) instr_Fx1E(x byte) {
-	log.Printf("set I = I + V[%x]\n", x)
 	cpu.R.I = cpu.R.I + rune(cpu.R.V[x])
 	cpu.R.PC += 2
 }
@@ -632,15 +1092,30 @@ func (cpu *CPU) instr_Fx1E(x byte) {
 // Set I = location of the sprite for digit Vx.
 //
 // The value of I is set to the location for the hexadecimal sprite corresponding to the value of Vx.
-func (cpu *CPU) instr_Fx29(x byte) {
-	log.Printf("set I = location of the sprite for digit V[%x] (%02x)\n", x, cpu.R.V[x])
+func (cpu *CPU) instr_Fx29(x byte) error {
 	addr, ok := display.SpritesAddresses[cpu.R.V[x]]
 	if !ok {
-		log.Panic("unkown sprite")
+		return fault(BadSprite, fmt.Errorf("no font sprite for digit %02x", cpu.R.V[x]))
+	}
+
+	cpu.R.I = addr
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0xFx30 - LD HF, Vx
+// Set I = location of the big sprite for digit Vx (SUPER-CHIP).
+//
+// The value of I is set to the location for the 8x10 hexadecimal sprite corresponding to the value of Vx.
+func (cpu *CPU) instr_Fx30(x byte) error {
+	addr, ok := display.BigSpritesAddresses[cpu.R.V[x]]
+	if !ok {
+		return fault(BadSprite, fmt.Errorf("no big font sprite for digit %02x", cpu.R.V[x]))
 	}
 
 	cpu.R.I = addr
 	cpu.R.PC += 2
+	return nil
 }
 
 // 0xFx33 - LD B, Vx
@@ -648,8 +1123,7 @@ func (cpu *CPU) instr_Fx29(x byte) {
 //
 // The interpreter takes the decimal value of Vx, and places the hundreds digit in memory at location I, the tens digit at location I+1,
 // and the ones digit at location I+2.
-func (cpu *CPU) instr_Fx33(x byte) {
-	log.Printf("stores BCD representation of V[%x] (0x%02x : %d) in memory location %04x %04x %04x\n", x, cpu.R.V[x], cpu.R.V[x], cpu.R.I, cpu.R.I+1, cpu.R.I+2)
+func (cpu *CPU) instr_Fx33(x byte) error {
 	value := cpu.R.V[x]
 	ones := value % 10
 	value /= 10
@@ -657,54 +1131,83 @@ func (cpu *CPU) instr_Fx33(x byte) {
 	value /= 10
 	hundreds := value % 10
 
-	log.Printf("set at memory location %04x 0x%02x (%d)\n", cpu.R.I, hundreds)
 	if err := cpu.Memory.SetByte(cpu.R.I, hundreds); err != nil {
-		log.Panic(err)
+		return fault(MemoryFault, err)
 	}
 
-	log.Printf("set at memory location %04x 0x%02x (%d)\n", cpu.R.I+1, tens)
 	if err := cpu.Memory.SetByte(cpu.R.I+1, tens); err != nil {
-		log.Panic(err)
+		return fault(MemoryFault, err)
 	}
 
-	log.Printf("set at memory location %04x 0x%02x (%d)\n", cpu.R.I+2, ones)
 	if err := cpu.Memory.SetByte(cpu.R.I+2, ones); err != nil {
-		log.Panic(err)
+		return fault(MemoryFault, err)
 	}
 
 	cpu.R.PC += 2
+	return nil
+}
+
+// 0xFx3A - PITCH Vx
+// Set the audio pitch = Vx (XO-CHIP).
+//
+// The pattern buffer is played at 4000*2^((Vx-64)/48) bits per second.
+func (cpu *CPU) instr_Fx3A(x byte) {
+	cpu.R.Pitch = cpu.R.V[x]
+	cpu.R.PC += 2
 }
 
 // 0xFx55 - LD [I], Vx
 // Store registers V0 through Vx in memory starting at location I.
 //
 // The interpreter copies the values of registers V0 through Vx into memory, starting at the address in I.
-func (cpu *CPU) instr_Fx55(x byte) {
-	log.Printf("store registers V[0] through V[%x] in memory starting at location %04x\n", x, cpu.R.I)
+// With the IncrementI quirk, I is then set to I + x + 1.
+func (cpu *CPU) instr_Fx55(x byte) error {
 	for i := 0; i <= int(x); i++ {
-		log.Printf("set at memory location %04x 0x%02x (%d)\n", cpu.R.I+rune(i), cpu.R.V[i])
 		if err := cpu.Memory.SetByte(cpu.R.I+rune(i), cpu.R.V[i]); err != nil {
-			log.Panic(err)
+			return fault(MemoryFault, err)
 		}
 	}
 
+	if cpu.Quirks.IncrementI {
+		cpu.R.I += rune(x) + 1
+	}
+
 	cpu.R.PC += 2
+	return nil
 }
 
 // 0xFx65 - LD Vx, [I]
 // Read registers V0 through Vx from memory starting at location I.
 //
 // The interpreter reads values from memory starting at location I into registers V0 through Vx.
-func (cpu *CPU) instr_Fx65(x byte) {
-	log.Printf("read registers V[0] through V[%x] from memory starting at location %04x\n", x, cpu.R.I)
+// With the IncrementI quirk, I is then set to I + x + 1.
+func (cpu *CPU) instr_Fx65(x byte) error {
 	for i := 0; i <= int(x); i++ {
 		b, err := cpu.Memory.GetByte(cpu.R.I + rune(i))
 		if err != nil {
-			log.Panic(err)
+			return fault(MemoryFault, err)
 		}
-		log.Printf("set V[%x] = 0x%02x (%d)\n", i, b, b)
 		cpu.R.V[i] = b
 	}
 
+	if cpu.Quirks.IncrementI {
+		cpu.R.I += rune(x) + 1
+	}
+
+	cpu.R.PC += 2
+	return nil
+}
+
+// 0xFx75 - LD R, Vx
+// Store registers V0 through Vx in the RPL user flags (SUPER-CHIP).
+func (cpu *CPU) instr_Fx75(x byte) {
+	copy(cpu.R.RPL[:x+1], cpu.R.V[:x+1])
+	cpu.R.PC += 2
+}
+
+// 0xFx85 - LD Vx, R
+// Read registers V0 through Vx from the RPL user flags (SUPER-CHIP).
+func (cpu *CPU) instr_Fx85(x byte) {
+	copy(cpu.R.V[:x+1], cpu.R.RPL[:x+1])
 	cpu.R.PC += 2
 }
@@ -1,6 +1,12 @@
 package cpu
 
-import "testing"
+import (
+	"errors"
+	"github.com/jordanabderrachid/go-chip8/display"
+	"github.com/jordanabderrachid/go-chip8/keyboard"
+	"github.com/jordanabderrachid/go-chip8/spu"
+	"testing"
+)
 
 func TestRegisterReset(t *testing.T) {
 	r := Registers{}
@@ -25,7 +31,7 @@ func TestInstr_00EE(t *testing.T) {
 		ExpectedPC rune
 	}{
 		{[16]rune{0x0000, 0x0001, 0x0002, 0x0003, 0x0004}, 0x04, 0x0034, 0x03, 0x0004},
-		{[16]rune{0x1234}, 0x00, 0x034, 0x00, 0x1234},
+		{[16]rune{0x0000, 0x1234}, 0x01, 0x034, 0x00, 0x1234},
 	}
 
 	for _, c := range tc {
@@ -38,7 +44,10 @@ func TestInstr_00EE(t *testing.T) {
 		cpu.R.SP = c.SP
 		cpu.R.PC = c.PC
 
-		cpu.instr_00EE()
+		if err := cpu.instr_00EE(); err != nil {
+			t.Fatal(err)
+		}
+
 		if cpu.R.SP != c.ExpectedSP {
 			t.Errorf("stack pointer should be 0x%02x, actual: 0x%02x\n", c.ExpectedSP, cpu.R.SP)
 		}
@@ -49,6 +58,26 @@ func TestInstr_00EE(t *testing.T) {
 	}
 }
 
+func TestInstr_00EE_Underflow(t *testing.T) {
+	cpu := &CPU{}
+	cpu.Reset()
+	cpu.LoadData([]byte{0x00, 0xEE})
+
+	_, err := cpu.Step()
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, actual: %v\n", err)
+	}
+
+	if e.Fault != StackUnderflow || e.PC != 0x200 || e.Opcode != 0x00EE {
+		t.Errorf("unexpected error %s\n", e)
+	}
+
+	if cpu.R.PC != 0x200 {
+		t.Errorf("program counter should be 0x0200, actual: 0x%04x\n", cpu.R.PC)
+	}
+}
+
 // 0x1nnn - JP addr
 // Jump to location nnn.
 //
@@ -101,7 +130,10 @@ func TestInstr_2nnn(t *testing.T) {
 		cpu.R.Stack = c.Stack
 		cpu.R.SP = c.SP
 		cpu.R.PC = c.PC
-		cpu.instr_2nnn(c.addr)
+		if err := cpu.instr_2nnn(c.addr); err != nil {
+			t.Fatal(err)
+		}
+
 		if cpu.R.PC != c.addr {
 			t.Errorf("program counter should be 0x%04x, actual: 0x%04x\n", c.addr, cpu.R.PC)
 		}
@@ -111,7 +143,609 @@ func TestInstr_2nnn(t *testing.T) {
 		}
 
 		if cpu.R.Stack != c.ExpectedStack {
-			t.Errorf("stack should be %s, actual: %s", c.ExpectedStack, cpu.R.Stack)
+			t.Errorf("stack should be %v, actual: %v", c.ExpectedStack, cpu.R.Stack)
+		}
+	}
+}
+
+func TestExecuteROM(t *testing.T) {
+	fb := new(display.FramebufferRenderer)
+	cpu := &CPU{Renderer: fb}
+	cpu.Reset()
+
+	// Draw the "0" font sprite at (0, 0).
+	cpu.LoadData([]byte{
+		0x60, 0x00, // LD V0, 0x00
+		0xF0, 0x29, // LD F, V0
+		0xD0, 0x05, // DRW V0, V0, 5
+	})
+
+	if _, err := cpu.StepN(3); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]byte{
+		{1, 1, 1, 1},
+		{1, 0, 0, 1},
+		{1, 0, 0, 1},
+		{1, 0, 0, 1},
+		{1, 1, 1, 1},
+	}
+	for y := range expected {
+		for x := range expected[y] {
+			if fb.Cells[y][x] != expected[y][x] {
+				t.Errorf("pixel (%d, %d) should be %d, actual: %d\n", x, y, expected[y][x], fb.Cells[y][x])
+			}
+		}
+	}
+}
+
+func TestStepN(t *testing.T) {
+	cpu := &CPU{CyclesPerFrame: 1}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xF0, 0x15, // LD DT, V0
+		0x70, 0x01, // ADD V0, 0x01
+		0x12, 0x04, // JP 0x204
+	})
+
+	res, err := cpu.StepN(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Cycles != 8 || res.PC != 0x0200 || res.NextPC != 0x0204 || res.Opcode != 0x1204 {
+		t.Errorf("unexpected step result %+v\n", res)
+	}
+
+	if cpu.R.V[0] != 0x08 {
+		t.Errorf("V0 should be 0x08, actual: 0x%02x\n", cpu.R.V[0])
+	}
+
+	if cpu.R.DT != 0x00 {
+		t.Errorf("delay timer should be 0x00, actual: 0x%02x\n", cpu.R.DT)
+	}
+
+	if cpu.R.PC != 0x0204 {
+		t.Errorf("program counter should be 0x0204, actual: 0x%04x\n", cpu.R.PC)
+	}
+}
+
+func TestExecuteOpcodeFaults(t *testing.T) {
+	tc := []struct {
+		rom   []byte
+		fault Fault
+	}{
+		{[]byte{0x00, 0x01}, IllegalOpcode},
+		{[]byte{0x5A, 0xB1}, IllegalOpcode},
+		{[]byte{0x22, 0x00}, StackOverflow},
+		{[]byte{0x60, 0x10, 0xF0, 0x29}, BadSprite},
+		{[]byte{0xF0, 0x00, 0xFF, 0xFF, 0xF1, 0x55}, MemoryFault},
+		{[]byte{0xF0, 0x00, 0xFF, 0xFE, 0xF0, 0x33}, MemoryFault},
+		{[]byte{0xF1, 0x00}, IllegalOpcode},
+	}
+
+	for _, c := range tc {
+		cpu := &CPU{}
+		cpu.Reset()
+		cpu.LoadData(c.rom)
+
+		_, err := cpu.StepN(32)
+		if e, ok := err.(*Error); !ok || e.Fault != c.fault {
+			t.Errorf("rom %x should fail with %s, actual: %v\n", c.rom, c.fault, err)
+		}
+	}
+}
+
+var errBackend = errors.New("backend failure")
+
+// failingRenderer fails once broken is set.
+type failingRenderer struct {
+	broken bool
+}
+
+func (f *failingRenderer) Init(width, height int) error { return f.err() }
+func (f *failingRenderer) Draw(cells [][]byte) error    { return f.err() }
+
+func (f *failingRenderer) err() error {
+	if f.broken {
+		return errBackend
+	}
+
+	return nil
+}
+
+// failingSink fails once broken is set.
+type failingSink struct {
+	broken bool
+}
+
+func (f *failingSink) Init(sampleRate int) error { return nil }
+
+func (f *failingSink) Write(samples []int8) error {
+	if f.broken {
+		return errBackend
+	}
+
+	return nil
+}
+
+func TestBackendErrors(t *testing.T) {
+	rom := []byte{
+		0x70, 0x01, // ADD V0, 0x01
+		0x00, 0xE0, // CLS
+	}
+
+	renderer := new(failingRenderer)
+	cpu := &CPU{Renderer: renderer, CyclesPerFrame: 4}
+	cpu.Reset()
+	cpu.LoadData(rom)
+	renderer.broken = true
+
+	_, err := cpu.StepN(2)
+	if e, ok := err.(*Error); !ok || e.Fault != DisplayFault || e.PC != 0x0202 || cpu.R.PC != 0x0202 {
+		t.Errorf("CLS should fail with a display fault at 0x0202, actual: %v, PC = 0x%04x\n", err, cpu.R.PC)
+	}
+
+	if err := cpu.Reset(); err == nil {
+		t.Errorf("Reset should fail when the renderer cannot be initialized\n")
+	}
+
+	sink := new(failingSink)
+	cpu = &CPU{AudioSink: sink, CyclesPerFrame: 1}
+	cpu.Reset()
+	cpu.LoadData(rom)
+	sink.broken = true
+
+	if _, err := cpu.Step(); err != errBackend || cpu.Cycles != 1 || cpu.R.PC != 0x0202 {
+		t.Errorf("the audio sink error should be returned after the instruction, actual: %v, PC = 0x%04x\n", err, cpu.R.PC)
+	}
+}
+
+func TestStep(t *testing.T) {
+	cpu := &CPU{}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x00, // LD V0, 0x00
+		0x00, 0xE0, // CLS
+	})
+
+	res, err := cpu.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Opcode != 0x6000 || res.PC != 0x0200 || res.NextPC != 0x0202 || res.ScreenChanged {
+		t.Errorf("unexpected step result %+v\n", res)
+	}
+
+	res, err = cpu.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Opcode != 0x00E0 || !res.ScreenChanged {
+		t.Errorf("unexpected step result %+v\n", res)
+	}
+
+	if cpu.Cycles != 2 {
+		t.Errorf("cycle count should be 2, actual: %d\n", cpu.Cycles)
+	}
+}
+
+func TestRunFrame(t *testing.T) {
+	cpu := &CPU{CyclesPerFrame: 4}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xF0, 0x15, // LD DT, V0
+		0x70, 0x01, // ADD V0, 0x01
+		0x12, 0x04, // JP 0x204
+	})
+
+	if _, err := cpu.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := cpu.RunFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Cycles != 3 || cpu.R.DT != 0x04 {
+		t.Errorf("frame should end after 3 instructions with DT = 0x04, actual: %d instructions, DT = 0x%02x\n", res.Cycles, cpu.R.DT)
+	}
+
+	cpu.CyclesPerFrame = 2
+	if err := cpu.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.Cycles != 8 || cpu.R.DT != 0x02 {
+		t.Errorf("expected 8 instructions with DT = 0x02, actual: %d instructions, DT = 0x%02x\n", cpu.Cycles, cpu.R.DT)
+	}
+
+	// lowering the speed in the middle of a frame ends it on the next instruction
+	cpu.CyclesPerFrame = 4
+	if _, err := cpu.StepN(3); err != nil {
+		t.Fatal(err)
+	}
+
+	cpu.CyclesPerFrame = 1
+	if err := cpu.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.Cycles != 13 || cpu.R.DT != 0x00 {
+		t.Errorf("expected 13 instructions with DT = 0x00, actual: %d instructions, DT = 0x%02x\n", cpu.Cycles, cpu.R.DT)
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	tc := []struct {
+		quirks     Quirks
+		rom        []byte
+		expectedV  [16]byte
+		expectedI  rune
+		expectedPC rune
+	}{
+		// 0x8xy6 shifts Vx, or Vy with ShiftVy
+		{Quirks{}, []byte{0x60, 0x05, 0x61, 0x80, 0x80, 0x16}, [16]byte{0x02, 0x80, 0xF: 0x01}, 0x0000, 0x0206},
+		{QuirksVIP, []byte{0x60, 0x05, 0x61, 0x80, 0x80, 0x16}, [16]byte{0x40, 0x80, 0xF: 0x00}, 0x0000, 0x0206},
+		// 0x8xyE sets VF to the shifted out bit
+		{Quirks{}, []byte{0x60, 0x81, 0x80, 0x0E}, [16]byte{0x02, 0xF: 0x01}, 0x0000, 0x0204},
+		// 0x8xy1 resets VF with ResetVF
+		{Quirks{}, []byte{0x6F, 0x01, 0x80, 0x11}, [16]byte{0xF: 0x01}, 0x0000, 0x0204},
+		{QuirksVIP, []byte{0x6F, 0x01, 0x80, 0x11}, [16]byte{0xF: 0x00}, 0x0000, 0x0204},
+		// 0xFx55 increments I with IncrementI
+		{Quirks{}, []byte{0xA3, 0x00, 0xF2, 0x55}, [16]byte{}, 0x0300, 0x0204},
+		{QuirksXOCHIP, []byte{0xA3, 0x00, 0xF2, 0x55}, [16]byte{}, 0x0303, 0x0204},
+		// 0xBnnn jumps to nnn + V0, or xnn + Vx with JumpVx
+		{Quirks{}, []byte{0x60, 0x02, 0x63, 0x04, 0xB3, 0x00}, [16]byte{0x02, 0x3: 0x04}, 0x0000, 0x0302},
+		{QuirksSCHIP, []byte{0x60, 0x02, 0x63, 0x04, 0xB3, 0x00}, [16]byte{0x02, 0x3: 0x04}, 0x0000, 0x0304},
+	}
+
+	for i, c := range tc {
+		cpu := &CPU{Quirks: c.quirks}
+		cpu.Reset()
+		cpu.LoadData(c.rom)
+
+		if _, err := cpu.StepN(len(c.rom) / 2); err != nil {
+			t.Fatal(err)
+		}
+
+		if cpu.R.V != c.expectedV || cpu.R.I != c.expectedI || cpu.R.PC != c.expectedPC {
+			t.Errorf("case %d: expected V = %x, I = 0x%04x, PC = 0x%04x, actual: V = %x, I = 0x%04x, PC = 0x%04x\n",
+				i, c.expectedV, c.expectedI, c.expectedPC, cpu.R.V, cpu.R.I, cpu.R.PC)
+		}
+	}
+}
+
+func TestSuperChip(t *testing.T) {
+	fb := new(display.FramebufferRenderer)
+	cpu := &CPU{Renderer: fb}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x00, 0xFF, // HIGH
+		0x60, 0x08, // LD V0, 0x08
+		0xF0, 0x30, // LD HF, V0
+		0x61, 0x70, // LD V1, 0x70
+		0xD1, 0x10, // DRW V1, V1, 0
+		0x00, 0xC2, // SCD 2
+		0x00, 0xFB, // SCR
+		0xF1, 0x75, // LD R, V1
+		0x60, 0x00, // LD V0, 0x00
+		0xF1, 0x85, // LD V1, R
+		0x00, 0xFD, // EXIT
+		0x60, 0xFF, // LD V0, 0xFF
+	})
+
+	if err := cpu.RunFrames(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cpu.Exited || cpu.R.PC != 0x0214 {
+		t.Errorf("program should have exited at 0x0214, actual: %t at 0x%04x\n", cpu.Exited, cpu.R.PC)
+	}
+
+	if cpu.R.V[0] != 0x08 || cpu.R.V[1] != 0x70 {
+		t.Errorf("V0 and V1 should be restored from the RPL flags, actual: 0x%02x 0x%02x\n", cpu.R.V[0], cpu.R.V[1])
+	}
+
+	if cpu.R.I != display.BigSpritesAddresses[0x08] {
+		t.Errorf("I should be 0x%04x, actual: 0x%04x\n", display.BigSpritesAddresses[0x08], cpu.R.I)
+	}
+
+	if len(fb.Cells) != display.HighResY || len(fb.Cells[0]) != display.HighResX {
+		t.Fatalf("display should be %dx%d, actual: %dx%d\n", display.HighResX, display.HighResY, len(fb.Cells[0]), len(fb.Cells))
+	}
+
+	// The first row of the big "8" is 0x3C at (0x70, 0x70 mod 64), moved by (4, 2).
+	row := fb.Cells[0x70%display.HighResY+2]
+	expected := []byte{0, 0, 1, 1, 1, 1, 0, 0}
+	for i, b := range expected {
+		if row[0x70+4+i] != b {
+			t.Errorf("pixel (%d, %d) should be %d, actual: %d\n", 0x70+4+i, 0x70%display.HighResY+2, b, row[0x70+4+i])
+		}
+	}
+}
+
+func TestInstr_Dxy0_LowRes(t *testing.T) {
+	tc := []struct {
+		quirks   Quirks
+		expected byte // pixel (8, 15), in the right half of a 16x16 sprite
+	}{
+		{Quirks{}, 1},
+		{QuirksXOCHIP, 1},
+		{QuirksSCHIP, 0},
+	}
+
+	for _, c := range tc {
+		fb := new(display.FramebufferRenderer)
+		cpu := &CPU{Renderer: fb, Quirks: c.quirks}
+		cpu.Reset()
+
+		rom := []byte{
+			0xA2, 0x04, // LD I, 0x204
+			0xD0, 0x00, // DRW V0, V0, 0
+		}
+		for i := 0; i < 32; i++ {
+			rom = append(rom, 0xFF)
+		}
+		cpu.LoadData(rom)
+
+		if _, err := cpu.StepN(2); err != nil {
+			t.Fatal(err)
+		}
+
+		if fb.Cells[15][7] != 1 || fb.Cells[15][8] != c.expected || fb.Cells[16][0] != 0 {
+			t.Errorf("%+v: pixels (7, 15), (8, 15) and (0, 16) should be 1, %d and 0, actual: %d, %d and %d\n",
+				c.quirks, c.expected, fb.Cells[15][7], fb.Cells[15][8], fb.Cells[16][0])
+		}
+	}
+}
+
+func TestXOChip(t *testing.T) {
+	fb := new(display.FramebufferRenderer)
+	cpu := &CPU{Renderer: fb}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x00, // LD V0, 0x00
+		0x30, 0x00, // SE V0, 0x00
+		0xF0, 0x00, 0x12, 0x34, // LD I, LONG 0x1234 (skipped)
+		0xF0, 0x00, 0x02, 0x1C, // LD I, LONG 0x021C
+		0xF3, 0x01, // PLANE 3
+		0xD0, 0x02, // DRW V0, V0, 2
+		0x00, 0xD1, // SCU 1
+		0x61, 0x11, // LD V1, 0x11
+		0x62, 0x22, // LD V2, 0x22
+		0x52, 0x12, // LD [I], V2 - V1
+		0x50, 0x23, // LD V0 - V2, [I]
+		0x13, 0x00, // JP 0x300
+		0x80, 0xC0, // plane 1 data
+		0xC0, 0x80, // plane 2 data
+	})
+
+	if _, err := cpu.StepN(11); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.R.I != 0x021C || cpu.R.PC != 0x0300 {
+		t.Errorf("expected I = 0x021C and PC = 0x0300, actual: I = 0x%04x, PC = 0x%04x\n", cpu.R.I, cpu.R.PC)
+	}
+
+	if cpu.R.V[0] != 0x22 || cpu.R.V[1] != 0x11 || cpu.R.V[2] != 0xC0 {
+		t.Errorf("expected V0-V2 = 22 11 c0, actual: %x\n", cpu.R.V[:3])
+	}
+
+	// The second row of the sprite is now the first one: 0xC0 on plane 1 and 0x80 on plane 2.
+	if fb.Cells[0][0] != 0x03 || fb.Cells[0][1] != 0x01 || fb.Cells[1][0] != 0x00 {
+		t.Errorf("unexpected framebuffer %x %x\n", fb.Cells[0][:2], fb.Cells[1][:2])
+	}
+}
+
+func TestSoundTimer(t *testing.T) {
+	sink := new(spu.MemorySink)
+	cpu := &CPU{AudioSink: sink, CyclesPerFrame: 1}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x02, // LD V0, 0x02
+		0xF0, 0x18, // LD ST, V0
+		0x12, 0x04, // JP 0x204
+	})
+
+	if err := cpu.RunFrames(4); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := len(sink.Samples) / 4
+	for i, expected := range []bool{false, true, true, false} {
+		sound := false
+		for _, v := range sink.Samples[i*frame : (i+1)*frame] {
+			if v != 0 {
+				sound = true
+			}
+		}
+
+		if sound != expected {
+			t.Errorf("frame %d should play a sound: %t, actual: %t\n", i, expected, sound)
+		}
+	}
+}
+
+func TestInstr_Cxkk(t *testing.T) {
+	run := func(seed int64) [16]byte {
+		cpu := &CPU{Seed: seed}
+		cpu.Reset()
+		cpu.LoadData([]byte{
+			0xC0, 0xFF, // RND V0, 0xFF
+			0xC1, 0xFF, // RND V1, 0xFF
+			0xC2, 0xFF, // RND V2, 0xFF
+			0xC3, 0x0F, // RND V3, 0x0F
+		})
+
+		if _, err := cpu.StepN(4); err != nil {
+			t.Fatal(err)
+		}
+
+		return cpu.R.V
+	}
+
+	v := run(1)
+	if v != run(1) {
+		t.Errorf("the same seed should draw the same bytes")
+	}
+
+	if v == run(2) {
+		t.Errorf("different seeds should draw different bytes")
+	}
+
+	if v[0x3]&0xF0 != 0 {
+		t.Errorf("V3 should be masked with 0x0F, actual: 0x%02x\n", v[0x3])
+	}
+}
+
+func TestInstr_Fx0A_Blocks(t *testing.T) {
+	cpu := &CPU{CyclesPerFrame: 2}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x05, // LD V0, 0x05
+		0xF0, 0x15, // LD DT, V0
+		0xF1, 0x0A, // LD V1, K
+	})
+
+	if err := cpu.RunFrames(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.R.PC != 0x0204 {
+		t.Errorf("program counter should stay on 0x0204, actual: 0x%04x\n", cpu.R.PC)
+	}
+
+	if cpu.R.DT != 0x02 {
+		t.Errorf("delay timer should keep running while waiting, expected 0x02, actual: 0x%02x\n", cpu.R.DT)
+	}
+}
+
+func TestInstr_Fx0A(t *testing.T) {
+	tc := []struct {
+		quirks     Quirks
+		expectedPC []rune // program counter after each frame
+	}{
+		// The keyboard is read at the end of each frame: the key goes down after the first frame and up after the third one.
+		{Quirks{}, []rune{0x0200, 0x0200, 0x0200, 0x0202}},
+		{Quirks{WaitKeyOnPress: true}, []rune{0x0200, 0x0202, 0x0202, 0x0202}},
+	}
+
+	for _, c := range tc {
+		input := &keyboard.ScriptedSource{Frames: []uint16{0x0080, 0x0080, 0x0000}}
+		cpu := &CPU{Input: input, Quirks: c.quirks, CyclesPerFrame: 1}
+		cpu.Reset()
+
+		cpu.LoadData([]byte{
+			0xF3, 0x0A, // LD V3, K
+			0x12, 0x02, // JP 0x202
+		})
+
+		for i, pc := range c.expectedPC {
+			if _, err := cpu.RunFrame(); err != nil {
+				t.Fatal(err)
+			}
+
+			if cpu.R.PC != pc {
+				t.Errorf("%+v: program counter should be 0x%04x after frame %d, actual: 0x%04x\n", c.quirks, pc, i, cpu.R.PC)
+			}
+		}
+
+		if cpu.R.V[3] != 0x07 {
+			t.Errorf("V3 should be 0x07, actual: 0x%02x\n", cpu.R.V[3])
+		}
+	}
+}
+
+func TestInstr_Fx0A_SameFrame(t *testing.T) {
+	input := &keyboard.ScriptedSource{Frames: []uint16{0x0080, 0x0080}}
+	cpu := &CPU{Input: input, Quirks: Quirks{WaitKeyOnPress: true}, CyclesPerFrame: 4}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0xF3, 0x0A, // LD V3, K
+		0xF4, 0x0A, // LD V4, K
+		0x12, 0x04, // JP 0x204
+	})
+
+	if err := cpu.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.R.PC != 0x0202 || cpu.R.V[3] != 0x07 || cpu.R.V[4] != 0x00 {
+		t.Errorf("only the first Fx0A should see the press, actual: PC = 0x%04x, V3 = 0x%02x, V4 = 0x%02x\n",
+			cpu.R.PC, cpu.R.V[3], cpu.R.V[4])
+	}
+}
+
+func TestInstr_Ex9E_ExA1(t *testing.T) {
+	input := &keyboard.ScriptedSource{Frames: []uint16{0x0004, 0x0004}}
+	cpu := &CPU{Input: input, CyclesPerFrame: 1}
+	cpu.Reset()
+
+	cpu.LoadData([]byte{
+		0x60, 0x02, // LD V0, 0x02
+		0xE0, 0x9E, // SKP V0
+		0x00, 0x00, // illegal, skipped
+		0xE0, 0xA1, // SKNP V0
+		0x61, 0x01, // LD V1, 0x01
+	})
+
+	if _, err := cpu.StepN(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.R.V[1] != 0x01 || cpu.R.PC != 0x020A {
+		t.Errorf("expected V1 = 0x01 and PC = 0x020A, actual: V1 = 0x%02x, PC = 0x%04x\n", cpu.R.V[1], cpu.R.PC)
+	}
+}
+
+func TestInstr_8xy4_8xy5_8xy7(t *testing.T) {
+	tc := []struct {
+		rom       []byte
+		expectedV [16]byte
+	}{
+		// 0x8xy4 sets VF on a carry
+		{[]byte{0x60, 0xFF, 0x61, 0x02, 0x80, 0x14}, [16]byte{0x01, 0x02, 0xF: 0x01}},
+		{[]byte{0x60, 0xFD, 0x61, 0x02, 0x80, 0x14}, [16]byte{0xFF, 0x02, 0xF: 0x00}},
+		// 0x8xy5 sets VF when Vx >= Vy
+		{[]byte{0x60, 0x05, 0x61, 0x05, 0x80, 0x15}, [16]byte{0x00, 0x05, 0xF: 0x01}},
+		{[]byte{0x60, 0x04, 0x61, 0x05, 0x80, 0x15}, [16]byte{0xFF, 0x05, 0xF: 0x00}},
+		// 0x8xy7 sets VF when Vy >= Vx
+		{[]byte{0x60, 0x05, 0x61, 0x05, 0x80, 0x17}, [16]byte{0x00, 0x05, 0xF: 0x01}},
+		{[]byte{0x60, 0x06, 0x61, 0x05, 0x80, 0x17}, [16]byte{0xFF, 0x05, 0xF: 0x00}},
+		// the flag is written after the result when x is F
+		{[]byte{0x6F, 0xFF, 0x61, 0x02, 0x8F, 0x14}, [16]byte{0x1: 0x02, 0xF: 0x01}},
+		{[]byte{0x6F, 0x06, 0x61, 0x05, 0x8F, 0x15}, [16]byte{0x1: 0x05, 0xF: 0x01}},
+		{[]byte{0x6F, 0x05, 0x61, 0x06, 0x8F, 0x17}, [16]byte{0x1: 0x06, 0xF: 0x01}},
+		{[]byte{0x6F, 0x06, 0x61, 0x05, 0x8F, 0x17}, [16]byte{0x1: 0x05, 0xF: 0x00}},
+	}
+
+	for i, c := range tc {
+		cpu := &CPU{}
+		cpu.Reset()
+		cpu.LoadData(c.rom)
+
+		if _, err := cpu.StepN(len(c.rom) / 2); err != nil {
+			t.Fatal(err)
+		}
+
+		if cpu.R.V != c.expectedV {
+			t.Errorf("case %d: expected V = %v, actual: %v\n", i, c.expectedV, cpu.R.V)
 		}
 	}
 }
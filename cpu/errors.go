@@ -0,0 +1,55 @@
+package cpu
+
+import "fmt"
+
+// Fault identifies the kind of error raised while executing an instruction.
+type Fault int
+
+const (
+	IllegalOpcode  Fault = iota // the opcode is not part of the instruction set
+	MemoryFault                 // an address outside of the memory was accessed
+	StackOverflow               // a CALL was made with a full stack
+	StackUnderflow              // a RET was made with an empty stack
+	BadSprite                   // a font sprite could not be located
+	DisplayFault                // the renderer failed to draw the framebuffer
+)
+
+func (f Fault) String() string {
+	switch f {
+	case IllegalOpcode:
+		return "illegal opcode"
+	case MemoryFault:
+		return "memory fault"
+	case StackOverflow:
+		return "stack overflow"
+	case StackUnderflow:
+		return "stack underflow"
+	case BadSprite:
+		return "bad sprite"
+	case DisplayFault:
+		return "display fault"
+	default:
+		return fmt.Sprintf("fault %d", int(f))
+	}
+}
+
+// Error is returned when an instruction cannot be executed. The program counter is left on the faulting instruction.
+type Error struct {
+	Fault  Fault
+	PC     rune  // address of the faulting instruction
+	Opcode rune  // faulting instruction
+	Err    error // underlying error, may be nil
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s at %04x (opcode %04x)", e.Fault, e.PC, e.Opcode)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func fault(f Fault, err error) error {
+	return &Error{Fault: f, Err: err}
+}
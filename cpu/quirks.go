@@ -0,0 +1,31 @@
+package cpu
+
+// Quirks selects how the instructions which behave differently between the CHIP-8 interpreters are executed.
+//
+// The zero value matches the behaviour described in Cowgod's Chip-8 Technical Reference.
+type Quirks struct {
+	ShiftVy     bool // 8xy6 and 8xyE shift Vy and store the result in Vx, instead of shifting Vx in place
+	IncrementI  bool // Fx55 and Fx65 leave I set to I + x + 1, instead of leaving it unchanged
+	JumpVx      bool // Bxnn jumps to xnn + Vx, instead of nnn + V0
+	ResetVF     bool // 8xy1, 8xy2 and 8xy3 set VF to 0
+	ClipSprites bool // Dxyn clips the sprites at the edges of the screen, instead of wrapping them around
+	TallSprites bool // Dxy0 draws an 8x16 sprite in low resolution as SUPER-CHIP 1.1, instead of a 16x16 one
+
+	WaitKeyOnPress bool // Fx0A completes when a key is pressed, instead of waiting for it to be released as the COSMAC VIP does
+}
+
+// Quirks profiles of the most common interpreters.
+var (
+	QuirksVIP    = Quirks{ShiftVy: true, IncrementI: true, ResetVF: true, ClipSprites: true} // COSMAC VIP
+	QuirksCHIP48 = Quirks{JumpVx: true, ClipSprites: true}                                   // CHIP-48 (HP48)
+	QuirksSCHIP  = Quirks{JumpVx: true, ClipSprites: true, TallSprites: true}                // SUPER-CHIP 1.1
+	QuirksXOCHIP = Quirks{ShiftVy: true, IncrementI: true}                                   // XO-CHIP (Octo)
+)
+
+// QuirksProfiles binds the names accepted on the command line to the quirks profiles.
+var QuirksProfiles = map[string]Quirks{
+	"vip":    QuirksVIP,
+	"chip48": QuirksCHIP48,
+	"schip":  QuirksSCHIP,
+	"xochip": QuirksXOCHIP,
+}
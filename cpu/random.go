@@ -0,0 +1,47 @@
+package cpu
+
+// A Random source draws the bytes of Cxkk. Its state is part of the save states, so that a restored machine draws the same
+// bytes as the original one.
+type Random interface {
+	Seed(seed int64)
+	Byte() byte
+	State() uint64
+	SetState(state uint64)
+}
+
+// XorShift is the default Random source, a xorshift64* generator.
+type XorShift struct {
+	s uint64
+}
+
+// Seed resets the generator. Every seed, including 0, gives a valid state.
+func (r *XorShift) Seed(seed int64) {
+	// splitmix64 spreads the seed over the 64 bits and never yields the all zero state for the seeds used in practice
+	z := uint64(seed) + 0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	r.SetState(z ^ (z >> 31))
+}
+
+func (r *XorShift) Byte() byte {
+	if r.s == 0 {
+		r.Seed(0)
+	}
+
+	r.s ^= r.s >> 12
+	r.s ^= r.s << 25
+	r.s ^= r.s >> 27
+	return byte((r.s * 0x2545F4914F6CDD1D) >> 56)
+}
+
+func (r *XorShift) State() uint64 {
+	return r.s
+}
+
+// SetState restores a state returned by State. The all zero state, which the generator can't leave, is replaced by a seeded one.
+func (r *XorShift) SetState(state uint64) {
+	r.s = state
+	if r.s == 0 {
+		r.s = 0x9E3779B97F4A7C15
+	}
+}
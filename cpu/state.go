@@ -0,0 +1,211 @@
+package cpu
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/display"
+	"github.com/jordanabderrachid/go-chip8/mmu"
+	"io"
+)
+
+// StateVersion is the version of the save state format written by SaveState.
+const StateVersion uint16 = 1
+
+var stateMagic = [4]byte{'C', '8', 'S', 'T'}
+
+// stateHeader starts every save state.
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+}
+
+// machineState is the fixed size part of a save state, followed by the memory, then by the Width x Height framebuffer.
+type machineState struct {
+	V       [16]byte
+	I       uint16
+	PC      uint16
+	Stack   [16]uint16
+	SP      byte
+	DT      byte
+	ST      byte
+	RPL     [16]byte
+	Pattern [16]byte
+	Pitch   byte
+
+	Cycles      uint64
+	FrameCycles uint32
+	Exited      bool
+	WaitingKey  bool
+	WaitedKey   byte
+
+	Keys         uint16
+	PreviousKeys uint16
+
+	Seed        int64
+	RandomState uint64
+
+	HighRes bool
+	Plane   byte
+	Width   uint16
+	Height  uint16
+}
+
+// check rejects the states which would crash the machine once restored.
+func (s *machineState) check() error {
+	if int(s.SP) >= len(s.Stack) {
+		return fmt.Errorf("invalid save state: stack pointer %d", s.SP)
+	}
+
+	if s.Plane > 0x03 {
+		return fmt.Errorf("invalid save state: plane %d", s.Plane)
+	}
+
+	lowRes := !s.HighRes && int(s.Width) == display.X && int(s.Height) == display.Y
+	highRes := s.HighRes && int(s.Width) == display.HighResX && int(s.Height) == display.HighResY
+	if !lowRes && !highRes {
+		return fmt.Errorf("invalid save state: %dx%d display in the wrong mode", s.Width, s.Height)
+	}
+
+	return nil
+}
+
+// SaveState writes the complete machine state: registers, memory, framebuffer, keyboard and random number generator.
+// Integers are big-endian.
+func (cpu *CPU) SaveState(w io.Writer) error {
+	s := machineState{
+		V:       cpu.R.V,
+		I:       uint16(cpu.R.I),
+		PC:      uint16(cpu.R.PC),
+		SP:      cpu.R.SP,
+		DT:      cpu.R.DT,
+		ST:      cpu.R.ST,
+		RPL:     cpu.R.RPL,
+		Pattern: cpu.R.Pattern,
+		Pitch:   cpu.R.Pitch,
+
+		Cycles:      cpu.Cycles,
+		FrameCycles: uint32(cpu.frameCycles),
+		Exited:      cpu.Exited,
+		WaitingKey:  cpu.waitingKey,
+		WaitedKey:   cpu.waitedKey,
+
+		Seed:        cpu.Seed,
+		RandomState: cpu.RNG.State(),
+
+		HighRes: cpu.Display.HighRes,
+		Plane:   cpu.Display.Plane,
+		Width:   uint16(cpu.Display.Width()),
+		Height:  uint16(cpu.Display.Height()),
+	}
+	for i, addr := range cpu.R.Stack {
+		s.Stack[i] = uint16(addr)
+	}
+	s.Keys, s.PreviousKeys = cpu.Keyboard.State()
+
+	if err := binary.Write(w, binary.BigEndian, stateHeader{stateMagic, StateVersion}); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, s); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(cpu.Memory.Dump()); err != nil {
+		return err
+	}
+
+	for _, row := range cpu.Display.Cells {
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StateHash returns the hex encoded SHA-1 of the save state of the machine. Two machines with the same hash behave the same.
+func (cpu *CPU) StateHash() (string, error) {
+	h := sha1.New()
+	if err := cpu.SaveState(h); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LoadState restores a machine state written by SaveState. The CPU must have been reset. On error, the CPU is left unchanged.
+func (cpu *CPU) LoadState(r io.Reader) error {
+	var h stateHeader
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return err
+	}
+
+	if h.Magic != stateMagic {
+		return fmt.Errorf("not a save state")
+	}
+
+	if h.Version != StateVersion {
+		return fmt.Errorf("unsupported save state version %d", h.Version)
+	}
+
+	var s machineState
+	if err := binary.Read(r, binary.BigEndian, &s); err != nil {
+		return err
+	}
+
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	mem := make([]byte, mmu.Size)
+	if _, err := io.ReadFull(r, mem); err != nil {
+		return err
+	}
+
+	cells := make([][]byte, s.Height)
+	for y := range cells {
+		cells[y] = make([]byte, s.Width)
+		if _, err := io.ReadFull(r, cells[y]); err != nil {
+			return err
+		}
+	}
+
+	if err := cpu.Memory.Restore(mem); err != nil {
+		return err
+	}
+
+	cpu.R.V = s.V
+	cpu.R.I = rune(s.I)
+	cpu.R.PC = rune(s.PC)
+	for i, addr := range s.Stack {
+		cpu.R.Stack[i] = rune(addr)
+	}
+	cpu.R.SP = s.SP
+	cpu.R.DT = s.DT
+	cpu.R.ST = s.ST
+	cpu.R.RPL = s.RPL
+	cpu.R.Pattern = s.Pattern
+	cpu.R.Pitch = s.Pitch
+
+	cpu.Cycles = s.Cycles
+	// the state may come from a faster machine, the frame then ends on the next instruction
+	cpu.frameCycles = int(s.FrameCycles)
+	if cpu.frameCycles < 0 || cpu.frameCycles >= cpu.Speed() {
+		cpu.frameCycles = cpu.Speed() - 1
+	}
+	cpu.Exited = s.Exited
+	cpu.waitingKey = s.WaitingKey
+	cpu.waitedKey = s.WaitedKey
+
+	cpu.Keyboard.SetState(s.Keys, s.PreviousKeys)
+
+	cpu.Seed = s.Seed
+	cpu.RNG.SetState(s.RandomState)
+
+	cpu.Display.HighRes = s.HighRes
+	cpu.Display.Plane = s.Plane
+	cpu.Display.Cells = cells
+	return cpu.Display.Redraw()
+}
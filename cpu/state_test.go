@@ -0,0 +1,176 @@
+package cpu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestSaveLoadState(t *testing.T) {
+	rom := []byte{
+		0x00, 0xFF, // HIGH
+		0xA2, 0x0C, // LD I, 0x20C
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x70, 0x01, // ADD V0, 0x01
+		0xC1, 0xFF, // RND V1, 0xFF
+		0x12, 0x04, // JP 0x204
+		0xF0, 0x90, 0x90, 0x90, 0xF0,
+	}
+
+	cpu := &CPU{CyclesPerFrame: 3, Seed: 42}
+	cpu.Reset()
+	cpu.LoadData(rom)
+	if err := cpu.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cpu.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	var state bytes.Buffer
+	if err := cpu.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cpu.RunFrames(5); err != nil {
+		t.Fatal(err)
+	}
+	expected := *cpu.R
+	expectedHash := cpu.Display.Hash()
+
+	restored := &CPU{CyclesPerFrame: 3}
+	restored.Reset()
+	if err := restored.LoadState(bytes.NewReader(state.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Seed != 42 {
+		t.Errorf("seed should be 42, actual: %d\n", restored.Seed)
+	}
+
+	if !restored.Display.HighRes || restored.Cycles != 7 {
+		t.Errorf("restored machine should be in high resolution after 7 instructions, actual: %v, %d instructions\n", restored.Display.HighRes, restored.Cycles)
+	}
+
+	if err := restored.RunFrames(5); err != nil {
+		t.Fatal(err)
+	}
+
+	if *restored.R != expected {
+		t.Errorf("registers should be %v, actual: %v\n", expected, *restored.R)
+	}
+
+	if restored.Display.Hash() != expectedHash {
+		t.Errorf("framebuffer hash should be %s, actual: %s\n", expectedHash, restored.Display.Hash())
+	}
+}
+
+func TestLoadStateInvalid(t *testing.T) {
+	cpu := &CPU{}
+	cpu.Reset()
+
+	var state bytes.Buffer
+	if err := cpu.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	b := state.Bytes()
+
+	tc := [][]byte{
+		[]byte("not a state"),
+		append([]byte{'C', '8', 'S', 'T', 0xFF, 0xFF}, b[6:]...),
+		b[:len(b)-1],
+	}
+
+	for _, c := range tc {
+		if err := cpu.LoadState(bytes.NewReader(c)); err == nil {
+			t.Errorf("loading %d bytes should fail\n", len(c))
+		}
+	}
+}
+
+func TestLoadStateCorrupted(t *testing.T) {
+	cpu := &CPU{}
+	cpu.Reset()
+
+	var state bytes.Buffer
+	if err := cpu.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []func(s *machineState){
+		func(s *machineState) { s.SP = 16 },
+		func(s *machineState) { s.Plane = 4 },
+		func(s *machineState) { s.Width, s.Height = 0, 0 },
+		func(s *machineState) { s.HighRes = true },
+		func(s *machineState) { s.Width, s.Height = 128, 64 },
+	}
+
+	for i, corrupt := range tc {
+		restored := &CPU{}
+		restored.Reset()
+		err := restored.LoadState(bytes.NewReader(rewriteState(state.Bytes(), corrupt)))
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid save state") {
+			t.Errorf("case %d: loading should fail with an invalid save state, actual: %v\n", i, err)
+		}
+
+		if restored.R.SP != 0 || restored.Display.Width() != 64 {
+			t.Errorf("case %d: the CPU should be left unchanged\n", i)
+		}
+	}
+}
+
+func TestLoadStateFrameCycles(t *testing.T) {
+	rom := []byte{
+		0x60, 0x0A, // LD V0, 0x0A
+		0xF0, 0x15, // LD DT, V0
+		0x12, 0x04, // JP 0x204
+	}
+
+	cpu := &CPU{CyclesPerFrame: 20}
+	cpu.Reset()
+	cpu.LoadData(rom)
+	if _, err := cpu.StepN(10); err != nil {
+		t.Fatal(err)
+	}
+
+	var state bytes.Buffer
+	if err := cpu.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := [][]byte{
+		state.Bytes(),
+		rewriteState(state.Bytes(), func(s *machineState) { s.FrameCycles = 0xFFFFFFFF }),
+	}
+
+	for i, c := range tc {
+		restored := &CPU{CyclesPerFrame: 5}
+		restored.Reset()
+		if err := restored.LoadState(bytes.NewReader(c)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := restored.RunFrames(10); err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Cycles != 10+1+9*5 || restored.R.DT != 0x00 {
+			t.Errorf("case %d: expected 56 instructions with DT = 0x00, actual: %d instructions, DT = 0x%02x\n", i, restored.Cycles, restored.R.DT)
+		}
+	}
+}
+
+// rewriteState returns a copy of the save state b, with its machineState changed by f.
+func rewriteState(b []byte, f func(s *machineState)) []byte {
+	b = append([]byte{}, b...)
+	n := binary.Size(stateHeader{})
+	var s machineState
+	binary.Read(bytes.NewReader(b[n:]), binary.BigEndian, &s)
+	f(&s)
+	var rewritten bytes.Buffer
+	binary.Write(&rewritten, binary.BigEndian, s)
+	copy(b[n:], rewritten.Bytes())
+
+	return b
+}
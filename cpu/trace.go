@@ -0,0 +1,120 @@
+package cpu
+
+import (
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"github.com/jordanabderrachid/go-chip8/mmu"
+)
+
+// The registers of the deltas are numbered from 0x0 to 0xF for V0 to VF, then I, SP, DT and ST.
+const (
+	RegI byte = 0x10 + iota
+	RegSP
+	RegDT
+	RegST
+)
+
+// A RegisterDelta is a register changed by an instruction.
+type RegisterDelta struct {
+	Register byte
+	Old, New rune
+}
+
+// Name returns the name of the register, like V0 or I.
+func (d RegisterDelta) Name() string {
+	switch d.Register {
+	case RegI:
+		return "I"
+	case RegSP:
+		return "SP"
+	case RegDT:
+		return "DT"
+	case RegST:
+		return "ST"
+	}
+
+	return fmt.Sprintf("V%X", d.Register)
+}
+
+// A MemoryWrite is a byte written by an instruction.
+type MemoryWrite struct {
+	Addr  rune
+	Value byte
+}
+
+// A Trace describes the execution of an instruction.
+type Trace struct {
+	Cycle     uint64 // number of instructions executed before this one since the reset
+	PC        rune
+	Opcode    rune   // first word of the instruction
+	Bytes     []byte // the instruction, 4 bytes long for F000 nnnn
+	Mnemonic  string
+	Registers []RegisterDelta // the registers changed by the instruction, in the order of their numbers
+	Writes    []MemoryWrite   // the bytes written by the instruction, in order
+}
+
+// A Tracer receives the trace of each instruction executed by the CPU. The trace and its slices are reused once Trace
+// returns.
+type Tracer interface {
+	Trace(t *Trace)
+}
+
+// beginTrace captures the state before the execution of an instruction.
+func (cpu *CPU) beginTrace(pc, opcode rune) {
+	t := &cpu.trace
+	t.Cycle, t.PC, t.Opcode = cpu.Cycles, pc, opcode
+	t.Registers, t.Writes = t.Registers[:0], t.Writes[:0]
+
+	t.Bytes = t.Bytes[:0]
+	for i := rune(0); i < 4; i++ {
+		b, err := cpu.Memory.GetByte(pc + i)
+		if err != nil {
+			break
+		}
+		t.Bytes = append(t.Bytes, b)
+	}
+	in := disasm.Decode(t.Bytes, pc)
+	t.Bytes, t.Mnemonic = t.Bytes[:in.Size()], in.Mnemonic
+
+	cpu.traceRegisters = *cpu.R
+
+	if cpu.traceMemory != cpu.Memory {
+		cpu.traceWrites()
+	}
+}
+
+// endTrace sends the trace of the executed instruction to the Tracer.
+func (cpu *CPU) endTrace() {
+	t := &cpu.trace
+	old, r := &cpu.traceRegisters, cpu.R
+	for i := range r.V {
+		if old.V[i] != r.V[i] {
+			t.Registers = append(t.Registers, RegisterDelta{byte(i), rune(old.V[i]), rune(r.V[i])})
+		}
+	}
+
+	deltas := []RegisterDelta{
+		{RegI, old.I, r.I},
+		{RegSP, rune(old.SP), rune(r.SP)},
+		{RegDT, rune(old.DT), rune(r.DT)},
+		{RegST, rune(old.ST), rune(r.ST)},
+	}
+	for _, d := range deltas {
+		if d.Old != d.New {
+			t.Registers = append(t.Registers, d)
+		}
+	}
+
+	cpu.Tracer.Trace(t)
+}
+
+// traceWrites records the memory writes of the instructions in the trace. It is installed on the first traced instruction
+// after each reset, so the Tracer can be set at any time.
+func (cpu *CPU) traceWrites() {
+	cpu.traceMemory = cpu.Memory
+	cpu.Memory.Watch(0, rune(mmu.Size-1), mmu.Write, func(h mmu.Hit) {
+		if cpu.executing && cpu.Tracer != nil {
+			cpu.trace.Writes = append(cpu.trace.Writes, MemoryWrite{h.Addr, h.Value})
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package cpu
+
+import (
+	"fmt"
+	"testing"
+)
+
+type traces []string
+
+func (tr *traces) Trace(t *Trace) {
+	*tr = append(*tr, fmt.Sprintf("%d %03X %X %s %v %v", t.Cycle, t.PC, t.Bytes, t.Mnemonic, t.Registers, t.Writes))
+}
+
+func TestTrace(t *testing.T) {
+	rom := []byte{
+		0x60, 0x7B, // 0x200 LD V0, 0x7B
+		0xF0, 0x00, 0x03, 0x00, // 0x202 LD I, LONG 0x300
+		0xF0, 0x33, // 0x206 LD B, V0
+		0x12, 0x08, // 0x208 JP 0x208
+	}
+
+	// the tracer is set after the reset, the memory writes are still traced
+	tr := new(traces)
+	cpu := &CPU{}
+	cpu.Reset()
+	cpu.LoadData(rom)
+	cpu.Tracer = tr
+
+	if _, err := cpu.StepN(4); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := traces{
+		"0 200 607B LD V0, 0x7B [{0 0 123}] []",
+		"1 202 F0000300 LD I, LONG 0x0300 [{16 0 768}] []",
+		"2 206 F033 LD B, V0 [] [{768 1} {769 2} {770 3}]",
+		"3 208 1208 JP 0x208 [] []",
+	}
+	if len(*tr) != len(expected) {
+		t.Fatalf("%d instructions should be traced, actual: %v\n", len(expected), *tr)
+	}
+	for i := range expected {
+		if (*tr)[i] != expected[i] {
+			t.Errorf("trace %d should be %q, actual: %q\n", i, expected[i], (*tr)[i])
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package cpu
+
+import (
+	"github.com/jordanabderrachid/go-chip8/mmu"
+)
+
+// A WatchHit reports an access of an instruction to a watched range of memory.
+type WatchHit struct {
+	mmu.Hit
+	PC     rune // address of the instruction
+	Opcode rune
+}
+
+// A Watchpoint watches the accesses of the instructions to the addresses from Start to End included.
+type Watchpoint struct {
+	Start, End rune
+	Access     mmu.Access     // mmu.Read, mmu.Write or both
+	Callback   func(WatchHit) // called on each hit, nil pauses the execution after the instruction instead
+}
+
+type watch struct {
+	id    int
+	w     Watchpoint
+	memID int // id of the watchpoint in the memory
+}
+
+// Watch adds a watchpoint, kept across the resets. It returns an id for Unwatch.
+func (cpu *CPU) Watch(w Watchpoint) int {
+	cpu.lastWatch++
+	cpu.watches = append(cpu.watches, &watch{id: cpu.lastWatch, w: w})
+	if cpu.Memory != nil {
+		cpu.install(cpu.watches[len(cpu.watches)-1])
+	}
+
+	return cpu.lastWatch
+}
+
+// Unwatch removes a watchpoint, and reports whether it existed.
+func (cpu *CPU) Unwatch(id int) bool {
+	for i, wt := range cpu.watches {
+		if wt.id == id {
+			if cpu.Memory != nil {
+				cpu.Memory.Unwatch(wt.memID)
+			}
+			cpu.watches = append(cpu.watches[:i], cpu.watches[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// install registers the watchpoint in the memory. The accesses made outside of ExecuteOpcode, like the fetch of the opcodes or
+// the reads of a debugger, are ignored.
+func (cpu *CPU) install(wt *watch) {
+	wt.memID = cpu.Memory.Watch(wt.w.Start, wt.w.End, wt.w.Access, func(h mmu.Hit) {
+		if !cpu.executing {
+			return
+		}
+
+		hit := WatchHit{Hit: h, PC: cpu.executingPC, Opcode: cpu.executingOpcode}
+		if wt.w.Callback != nil {
+			wt.w.Callback(hit)
+		} else {
+			cpu.watchHits = append(cpu.watchHits, hit)
+		}
+	})
+}
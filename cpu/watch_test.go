@@ -0,0 +1,58 @@
+package cpu
+
+import (
+	"github.com/jordanabderrachid/go-chip8/mmu"
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	rom := []byte{
+		0x60, 0x7B, // 0x200 LD V0, 0x7B
+		0xA3, 0x00, // 0x202 LD I, 0x300
+		0xF0, 0x33, // 0x204 LD B, V0
+		0xF0, 0x65, // 0x206 LD V0, [I]
+		0x12, 0x08, // 0x208 JP 0x208
+	}
+
+	cpu := &CPU{}
+	id := cpu.Watch(Watchpoint{Start: 0x301, End: 0x302, Access: mmu.Write})
+	cpu.Reset()
+	cpu.LoadData(rom)
+
+	res, err := cpu.StepN(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []WatchHit{
+		{mmu.Hit{Addr: 0x301, Access: mmu.Write, Value: 0x02}, 0x204, 0xF033},
+		{mmu.Hit{Addr: 0x302, Access: mmu.Write, Value: 0x03}, 0x204, 0xF033},
+	}
+	if len(res.Watch) != len(expected) || res.Watch[0] != expected[0] || res.Watch[1] != expected[1] {
+		t.Errorf("hits should be %v, actual: %v\n", expected, res.Watch)
+	}
+
+	if res.Cycles != 3 || cpu.R.PC != 0x206 {
+		t.Errorf("execution should pause after 3 instructions at 0x206, actual: %d instructions at 0x%03x\n", res.Cycles, cpu.R.PC)
+	}
+
+	// the watchpoints are kept across the resets, and the fetch of the opcodes is not an access
+	cpu.Unwatch(id)
+	var reads []WatchHit
+	cpu.Watch(Watchpoint{Start: 0x200, End: 0x302, Access: mmu.Read, Callback: func(h WatchHit) { reads = append(reads, h) }})
+	cpu.Reset()
+	cpu.LoadData(rom)
+
+	res, err = cpu.StepN(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Cycles != 10 || len(res.Watch) != 0 {
+		t.Errorf("callback watchpoints should not pause, actual: %d instructions, hits %v\n", res.Cycles, res.Watch)
+	}
+
+	if len(reads) != 1 || reads[0].Addr != 0x300 || reads[0].Value != 0x01 || reads[0].PC != 0x206 {
+		t.Errorf("Fx65 should read 0x01 at 0x300, actual: %v\n", reads)
+	}
+}
@@ -0,0 +1,858 @@
+// Package dap is a Debug Adapter Protocol server, for editors to launch and debug ROMs.
+//
+// The programs written in the assembler syntax (.asm) or in Octo (.8o) are built by the launch request, and their source
+// map lets the editor set breakpoints on source lines. The other files are loaded as ROMs, and debugged through the
+// disassembly. The CPU has a single thread, the registers are its only scope, and the evaluate request reads a register or runs
+// a command of the monitor package: the ones reading the machine, press and release for the keypad, and the ones
+// executing instructions, which run like the requests of the editor.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/asm"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"github.com/jordanabderrachid/go-chip8/mmu"
+	"github.com/jordanabderrachid/go-chip8/monitor"
+	"github.com/jordanabderrachid/go-chip8/octo"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pollInterval is the number of instructions executed by a running session between two reads of the requests.
+const pollInterval = 1000
+
+const (
+	threadID     = 1
+	registersRef = 1 // variables reference of the registers scope
+)
+
+// ListenAndServe listens on the TCP address and serves the sessions, one at a time, until an error occurs.
+func ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		err = Serve(conn, conn)
+		conn.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// Serve runs a session reading the requests from r and writing the responses and the events to w, until the editor
+// disconnects or r is closed.
+func Serve(r io.Reader, w io.Writer) error {
+	ss := &session{
+		w:        w,
+		requests: make(chan *request, 16),
+		lines:    make(map[string][]int),
+	}
+
+	// the requests are read in the background, to notice them while the CPU runs
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			b, err := readMessage(br)
+			req := new(request)
+			if err == nil {
+				err = json.Unmarshal(b, req)
+			}
+			if err != nil {
+				ss.err = err
+				close(ss.requests)
+				return
+			}
+
+			select {
+			case ss.requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for !ss.quit {
+		var req *request
+		var ok bool
+		if ss.running {
+			select {
+			case req, ok = <-ss.requests:
+			default:
+				if err := ss.run(); err != nil {
+					return err
+				}
+				continue
+			}
+		} else {
+			req, ok = <-ss.requests
+		}
+
+		if !ok {
+			return ss.err
+		}
+
+		if err := ss.handle(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type session struct {
+	w        io.Writer
+	seq      int
+	requests chan *request
+	err      error // error of the reader, once requests is closed
+
+	cpu         *cpu.CPU
+	program     *asm.Program // source map of the program, nil for a ROM
+	monitor     *monitor.Monitor
+	out         bytes.Buffer // output of the monitor
+	stopOnEntry bool
+	quit        bool
+
+	running bool
+	done    func() bool // stops the CPU before a breakpoint, nil for continue
+	reason  string      // reason of the stop when done
+
+	lines        map[string][]int // lines of the source breakpoints by file
+	instructions []rune           // addresses of the instruction breakpoints
+	breakpoints  map[rune]bool
+}
+
+type launchArguments struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	Quirks      string `json:"quirks"`
+	Speed       int    `json:"speed"`
+	Seed        int64  `json:"seed"`
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type breakpoint struct {
+	Verified             bool    `json:"verified"`
+	Message              string  `json:"message,omitempty"`
+	Source               *source `json:"source,omitempty"`
+	Line                 int     `json:"line,omitempty"`
+	InstructionReference string  `json:"instructionReference,omitempty"`
+}
+
+type stackFrame struct {
+	ID                          int     `json:"id"`
+	Name                        string  `json:"name"`
+	Source                      *source `json:"source,omitempty"`
+	Line                        int     `json:"line"`
+	Column                      int     `json:"column"`
+	InstructionPointerReference string  `json:"instructionPointerReference"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+	MemoryReference    string `json:"memoryReference,omitempty"`
+}
+
+type instruction struct {
+	Address          string  `json:"address"`
+	InstructionBytes string  `json:"instructionBytes,omitempty"`
+	Instruction      string  `json:"instruction"`
+	Location         *source `json:"location,omitempty"`
+	Line             int     `json:"line,omitempty"`
+}
+
+func (ss *session) send(msg interface{}) error {
+	ss.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = ss.seq
+	case *event:
+		m.Seq = ss.seq
+	}
+
+	return writeMessage(ss.w, msg)
+}
+
+func (ss *session) event(name string, body interface{}) error {
+	return ss.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// stopped stops the CPU and tells the editor why.
+func (ss *session) stopped(reason, description string) error {
+	ss.running = false
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if description != "" {
+		body["description"] = description
+		body["text"] = description
+	}
+
+	return ss.event("stopped", body)
+}
+
+// handle executes a request and writes its response, and the events that follow it.
+func (ss *session) handle(req *request) error {
+	body, err := ss.execute(req)
+	res := &response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: body}
+	if err != nil {
+		res.Message = err.Error()
+	}
+
+	if err := ss.send(res); err != nil {
+		return err
+	}
+
+	if err != nil {
+		return nil
+	}
+
+	switch req.Command {
+	case "launch":
+		// the breakpoints set once initialized are resolved against the launched program
+		return ss.event("initialized", nil)
+	case "configurationDone":
+		if ss.stopOnEntry {
+			return ss.stopped("entry", "")
+		}
+		ss.resume(nil, "")
+	case "pause":
+		if ss.running {
+			return ss.stopped("pause", "")
+		}
+	}
+
+	return nil
+}
+
+// needsProgram are the requests which can't be executed before the launch.
+var needsProgram = map[string]bool{
+	"configurationDone": true,
+	"stackTrace":        true,
+	"scopes":            true,
+	"variables":         true,
+	"setVariable":       true,
+	"evaluate":          true,
+	"readMemory":        true,
+	"writeMemory":       true,
+	"disassemble":       true,
+	"continue":          true,
+	"pause":             true,
+	"stepIn":            true,
+	"stepBack":          true,
+	"next":              true,
+	"stepOut":           true,
+}
+
+func (ss *session) execute(req *request) (interface{}, error) {
+	if needsProgram[req.Command] && ss.cpu == nil {
+		return nil, fmt.Errorf("no program is launched")
+	}
+
+	switch req.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsDisassembleRequest":       true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsReadMemoryRequest":        true,
+			"supportsWriteMemoryRequest":       true,
+			"supportsSetVariable":              true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, ss.launch(args)
+	case "configurationDone":
+		return nil, nil
+	case "disconnect", "terminate":
+		ss.quit = true
+		return nil, nil
+	case "setBreakpoints":
+		return ss.setBreakpoints(req.Arguments)
+	case "setInstructionBreakpoints":
+		return ss.setInstructionBreakpoints(req.Arguments)
+	case "threads":
+		return map[string]interface{}{"threads": []map[string]interface{}{{"id": threadID, "name": "chip8"}}}, nil
+	case "stackTrace":
+		return ss.stackTrace(), nil
+	case "scopes":
+		return map[string]interface{}{"scopes": []map[string]interface{}{
+			{"name": "Registers", "variablesReference": registersRef, "expensive": false},
+		}}, nil
+	case "variables":
+		return ss.variables(), nil
+	case "setVariable":
+		var args struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if _, err := ss.monitor.Exec("set " + args.Name + " " + args.Value); err != nil {
+			return nil, err
+		}
+		for _, v := range ss.variables()["variables"] {
+			if v.Name == args.Name {
+				return map[string]string{"value": v.Value}, nil
+			}
+		}
+		return nil, fmt.Errorf("no variable %s", args.Name)
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return ss.evaluate(args.Expression)
+	case "readMemory":
+		return ss.readMemory(req.Arguments)
+	case "writeMemory":
+		return ss.writeMemory(req.Arguments)
+	case "disassemble":
+		return ss.disassemble(req.Arguments)
+	case "continue":
+		ss.resume(nil, "")
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "pause":
+		return nil, nil
+	case "stepIn", "stepBack":
+		if req.Command == "stepBack" {
+			return nil, fmt.Errorf("stepping back isn't supported")
+		}
+		ss.step(1)
+		return nil, nil
+	case "next":
+		ss.next()
+		return nil, nil
+	case "stepOut":
+		return nil, ss.stepOut()
+	}
+
+	return nil, fmt.Errorf("unsupported request %s", req.Command)
+}
+
+// consoleCommands are the commands of the monitor run by evaluate. The others would change the breakpoints or the state of the
+// machine behind the back of the session.
+var consoleCommands = map[string]bool{
+	"regs": true, "r": true, "mem": true, "x": true, "list": true, "l": true, "stack": true, "press": true, "release": true,
+}
+
+// evaluate returns the value of a register, or runs a command typed in the debug console. The commands executing
+// instructions run like the requests of the editor, until they stop on their own, a breakpoint or a pause.
+func (ss *session) evaluate(expression string) (interface{}, error) {
+	for _, v := range ss.variables()["variables"] {
+		if strings.EqualFold(v.Name, expression) {
+			return map[string]interface{}{"result": v.Value, "variablesReference": 0, "memoryReference": v.MemoryReference}, nil
+		}
+	}
+
+	args := strings.Fields(expression)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	switch args[0] {
+	case "step", "s":
+		n := uint64(1)
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.ParseUint(args[1], 0, 31); err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid number of instructions %s", args[1])
+			}
+		}
+		ss.step(int(n))
+	case "next", "n":
+		ss.next()
+	case "finish":
+		if err := ss.stepOut(); err != nil {
+			return nil, err
+		}
+	case "continue", "c":
+		ss.resume(nil, "")
+	default:
+		if !consoleCommands[args[0]] {
+			return nil, fmt.Errorf("%s can't be used in the debug console", args[0])
+		}
+
+		ss.out.Reset()
+		if _, err := ss.monitor.Exec(expression); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": strings.TrimSpace(ss.out.String()), "variablesReference": 0}, nil
+	}
+
+	return map[string]interface{}{"result": "running", "variablesReference": 0}, nil
+}
+
+// step executes n instructions.
+func (ss *session) step(n int) {
+	ss.resume(func() bool {
+		n--
+		return n == 0
+	}, "step")
+}
+
+// next executes an instruction, running the subroutine calls to their return.
+func (ss *session) next() {
+	c := ss.cpu
+	if in := ss.decode(c.R.PC); in.Flow == disasm.Call {
+		sp, ret := c.R.SP, c.R.PC+2
+		ss.resume(func() bool { return c.R.PC == ret && c.R.SP == sp }, "step")
+	} else {
+		ss.step(1)
+	}
+}
+
+// stepOut runs until the current subroutine returns.
+func (ss *session) stepOut() error {
+	c := ss.cpu
+	if c.R.SP == 0 {
+		return fmt.Errorf("not in a subroutine")
+	}
+
+	sp := c.R.SP
+	ss.resume(func() bool { return c.R.SP < sp }, "step")
+	return nil
+}
+
+// launch builds the program, and loads it in a new CPU under a monitor.
+func (ss *session) launch(args launchArguments) error {
+	if args.Program == "" {
+		return fmt.Errorf("missing program")
+	}
+
+	path, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+
+	var rom []byte
+	var program *asm.Program
+	switch filepath.Ext(path) {
+	case ".asm":
+		program, err = asm.AssembleFile(path)
+	case ".8o":
+		program, err = octo.CompileFile(path)
+	default:
+		rom, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	if program != nil {
+		rom = program.Bytes
+	}
+
+	c := &cpu.CPU{CyclesPerFrame: args.Speed, Seed: args.Seed}
+	if args.Quirks != "" {
+		q, ok := cpu.QuirksProfiles[args.Quirks]
+		if !ok {
+			return fmt.Errorf("unknown quirks profile %q", args.Quirks)
+		}
+		c.Quirks = q
+	}
+	if c.CyclesPerFrame == 0 {
+		c.CyclesPerFrame = cpu.DefaultCyclesPerFrame
+	}
+
+	m, err := monitor.New(c, nil, &ss.out)
+	if err != nil {
+		return err
+	}
+
+	if err := c.LoadData(rom); err != nil {
+		return err
+	}
+
+	ss.cpu, ss.program, ss.monitor = c, program, m
+	ss.stopOnEntry = args.StopOnEntry
+	ss.updateBreakpoints()
+	return nil
+}
+
+// resume runs the CPU until done, or until a breakpoint when done is nil.
+func (ss *session) resume(done func() bool, reason string) {
+	ss.running = true
+	ss.done = done
+	ss.reason = reason
+}
+
+// run executes instructions for a while, until the CPU stops.
+func (ss *session) run() error {
+	c := ss.cpu
+	for i := 0; i < pollInterval; i++ {
+		if c.Exited {
+			ss.running = false
+			if err := ss.event("exited", map[string]int{"exitCode": 0}); err != nil {
+				return err
+			}
+			return ss.event("terminated", nil)
+		}
+
+		res, err := c.Step()
+		if err != nil {
+			return ss.stopped("exception", err.Error())
+		}
+
+		if len(res.Watch) > 0 {
+			h := res.Watch[0]
+			return ss.stopped("data breakpoint", fmt.Sprintf("%s 0x%02X at 0x%04X", h.Access, h.Value, h.Addr))
+		}
+
+		if ss.done != nil && ss.done() {
+			return ss.stopped(ss.reason, "")
+		}
+
+		if ss.breakpoints[c.R.PC] {
+			return ss.stopped("breakpoint", "")
+		}
+
+		if ss.done == nil && res.NextPC == res.PC && !c.Exited {
+			return ss.stopped("pause", fmt.Sprintf("the program is stuck at 0x%03X", c.R.PC))
+		}
+	}
+
+	return nil
+}
+
+func (ss *session) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source      source `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Clean(args.Source.Path)
+	lines := make([]int, 0, len(args.Breakpoints))
+	for _, b := range args.Breakpoints {
+		lines = append(lines, b.Line)
+	}
+	ss.lines[path] = lines
+	ss.updateBreakpoints()
+
+	breakpoints := make([]breakpoint, 0, len(lines))
+	for _, line := range lines {
+		b := breakpoint{Source: &args.Source, Line: line}
+		if addr, actual, ok := ss.lineAddress(path, line); ok {
+			b.Verified, b.Line, b.InstructionReference = true, actual, reference(addr)
+		} else if ss.program == nil {
+			b.Message = "the program isn't launched from a source file"
+		} else {
+			b.Message = "no instruction at or after this line"
+		}
+		breakpoints = append(breakpoints, b)
+	}
+
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (ss *session) setInstructionBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	ss.instructions = ss.instructions[:0]
+	breakpoints := make([]breakpoint, 0, len(args.Breakpoints))
+	for _, b := range args.Breakpoints {
+		addr, err := parseReference(b.InstructionReference)
+		if err != nil {
+			breakpoints = append(breakpoints, breakpoint{Message: err.Error()})
+			continue
+		}
+		addr += rune(b.Offset)
+		ss.instructions = append(ss.instructions, addr)
+		breakpoints = append(breakpoints, breakpoint{Verified: true, InstructionReference: reference(addr)})
+	}
+	ss.updateBreakpoints()
+
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// updateBreakpoints gathers the addresses of the source and the instruction breakpoints.
+func (ss *session) updateBreakpoints() {
+	ss.breakpoints = make(map[rune]bool)
+	for _, addr := range ss.instructions {
+		ss.breakpoints[addr] = true
+	}
+
+	for path, lines := range ss.lines {
+		for _, line := range lines {
+			if addr, _, ok := ss.lineAddress(path, line); ok {
+				ss.breakpoints[addr] = true
+			}
+		}
+	}
+}
+
+// lineAddress returns the first address of the first line of the file with code, starting at line.
+func (ss *session) lineAddress(path string, line int) (rune, int, bool) {
+	if ss.program == nil {
+		return 0, 0, false
+	}
+
+	found := false
+	var addr rune
+	var actual int
+	for a, l := range ss.program.Lines {
+		if filepath.Clean(l.File) != path || l.Line < line {
+			continue
+		}
+
+		if !found || l.Line < actual || l.Line == actual && a < addr {
+			found, addr, actual = true, a, l.Line
+		}
+	}
+
+	return addr, actual, found
+}
+
+// stackTrace returns the frame of the PC, then the frames of the subroutine calls.
+func (ss *session) stackTrace() interface{} {
+	c := ss.cpu
+	frames := []stackFrame{ss.frame(0, c.R.PC)}
+	for i := int(c.R.SP); i > 0; i-- {
+		// the stack holds the return addresses, the call is the instruction before
+		frames = append(frames, ss.frame(len(frames), c.R.Stack[i]-2))
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func (ss *session) frame(id int, addr rune) stackFrame {
+	f := stackFrame{
+		ID:                          id,
+		Name:                        fmt.Sprintf("0x%03X  %s", addr, ss.decode(addr).Mnemonic),
+		Column:                      1,
+		InstructionPointerReference: reference(addr),
+	}
+
+	if s, line, ok := ss.source(addr); ok {
+		f.Source, f.Line = s, line
+	}
+
+	return f
+}
+
+func (ss *session) source(addr rune) (*source, int, bool) {
+	if ss.program == nil {
+		return nil, 0, false
+	}
+
+	l, ok := ss.program.Lines[addr]
+	if !ok {
+		return nil, 0, false
+	}
+
+	return &source{Name: filepath.Base(l.File), Path: l.File}, l.Line, true
+}
+
+func (ss *session) variables() map[string][]variable {
+	r := ss.cpu.R
+	vars := make([]variable, 0, 21)
+	for i, v := range r.V {
+		vars = append(vars, variable{Name: fmt.Sprintf("V%X", i), Value: fmt.Sprintf("0x%02X", v)})
+	}
+
+	vars = append(vars,
+		variable{Name: "I", Value: fmt.Sprintf("0x%03X", r.I), MemoryReference: reference(r.I)},
+		variable{Name: "PC", Value: fmt.Sprintf("0x%03X", r.PC), MemoryReference: reference(r.PC)},
+		variable{Name: "SP", Value: fmt.Sprintf("0x%02X", r.SP)},
+		variable{Name: "DT", Value: fmt.Sprintf("0x%02X", r.DT)},
+		variable{Name: "ST", Value: fmt.Sprintf("0x%02X", r.ST)},
+	)
+
+	return map[string][]variable{"variables": vars}
+}
+
+func (ss *session) readMemory(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr += rune(args.Offset)
+
+	if args.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d", args.Count)
+	}
+
+	n := args.Count
+	if n > mmu.Size {
+		n = mmu.Size
+	}
+
+	b := make([]byte, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := ss.cpu.Memory.GetByte(addr + rune(i))
+		if err != nil {
+			break
+		}
+		b = append(b, v)
+	}
+
+	return map[string]interface{}{
+		"address":         reference(addr),
+		"data":            base64.StdEncoding.EncodeToString(b),
+		"unreadableBytes": args.Count - len(b),
+	}, nil
+}
+
+func (ss *session) writeMemory(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr += rune(args.Offset)
+
+	b, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range b {
+		if err := ss.cpu.Memory.SetByte(addr+rune(i), v); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]int{"bytesWritten": len(b)}, nil
+}
+
+// disassemble decodes instructionCount instructions, counted from instructionOffset instructions after the reference.
+// The instructions before the reference are assumed to be 2 bytes long.
+func (ss *session) disassemble(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseReference(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr += rune(args.Offset)
+
+	// no more instructions than the 2 bytes ones filling the memory are decoded
+	max := mmu.Size / 2
+	if args.InstructionCount < 0 || args.InstructionCount > max {
+		return nil, fmt.Errorf("invalid instruction count %d", args.InstructionCount)
+	}
+
+	if args.InstructionOffset < 0 {
+		if args.InstructionOffset < -max {
+			args.InstructionOffset = -max
+		}
+		addr += 2 * rune(args.InstructionOffset)
+	}
+	for i := 0; i < args.InstructionOffset && i < max; i++ {
+		addr += rune(ss.decode(addr).Size())
+	}
+
+	instructions := make([]instruction, 0, args.InstructionCount)
+	for i := 0; i < args.InstructionCount; i++ {
+		if addr < 0 || addr >= rune(mmu.Size) {
+			instructions = append(instructions, instruction{Address: reference(addr), Instruction: "??"})
+			addr += 2
+			continue
+		}
+
+		in := ss.decode(addr)
+		ins := instruction{Address: reference(addr), InstructionBytes: fmt.Sprintf("% X", in.Bytes), Instruction: in.Mnemonic}
+		if s, line, ok := ss.source(addr); ok {
+			ins.Location, ins.Line = s, line
+		}
+		instructions = append(instructions, ins)
+		addr += rune(in.Size())
+	}
+
+	return map[string]interface{}{"instructions": instructions}, nil
+}
+
+// decode decodes the instruction at addr, from the memory of the CPU.
+func (ss *session) decode(addr rune) disasm.Instruction {
+	b := make([]byte, 0, 4)
+	for i := rune(0); i < 4; i++ {
+		v, err := ss.cpu.Memory.GetByte(addr + i)
+		if err != nil {
+			break
+		}
+		b = append(b, v)
+	}
+
+	return disasm.Decode(b, addr)
+}
+
+// reference formats an address as a memory or instruction reference.
+func reference(addr rune) string {
+	return fmt.Sprintf("0x%04X", addr)
+}
+
+func parseReference(s string) (rune, error) {
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad reference %q", s)
+	}
+
+	return rune(v), nil
+}
@@ -0,0 +1,346 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const program = `; test program
+start:
+	LD V0, 0x01
+	CALL sub
+	ADD V0, 0x01
+	EXIT
+
+sub:
+	ADD V1, 0x10
+	RET
+`
+
+type message struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	RequestSeq int             `json:"request_seq"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (cl *client) send(command string, arguments interface{}) {
+	cl.seq++
+	msg := map[string]interface{}{"seq": cl.seq, "type": "request", "command": command, "arguments": arguments}
+	if err := writeMessage(cl.w, msg); err != nil {
+		cl.t.Fatal(err)
+	}
+}
+
+// expect reads the messages until the response to command, or the event, named name.
+func (cl *client) expect(typ, name string, body interface{}) message {
+	for {
+		b, err := readMessage(cl.r)
+		if err != nil {
+			cl.t.Fatalf("waiting for %s %s: %s", typ, name, err)
+		}
+
+		var m message
+		if err := json.Unmarshal(b, &m); err != nil {
+			cl.t.Fatal(err)
+		}
+
+		if m.Type != typ || m.Command+m.Event != name {
+			continue
+		}
+
+		if typ == "response" && !m.Success {
+			cl.t.Fatalf("%s failed: %s", name, m.Message)
+		}
+
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				cl.t.Fatal(err)
+			}
+		}
+
+		return m
+	}
+}
+
+// call sends a request and returns its response.
+func (cl *client) call(command string, arguments interface{}, body interface{}) message {
+	cl.send(command, arguments)
+	return cl.expect("response", command, body)
+}
+
+// callFailing sends a request which should fail, and returns the message of its response.
+func (cl *client) callFailing(command string, arguments interface{}) string {
+	cl.send(command, arguments)
+	for {
+		b, err := readMessage(cl.r)
+		if err != nil {
+			cl.t.Fatal(err)
+		}
+
+		var m message
+		if err := json.Unmarshal(b, &m); err != nil {
+			cl.t.Fatal(err)
+		}
+
+		if m.Type == "response" && m.Command == command {
+			if m.Success {
+				cl.t.Errorf("%s should fail", command)
+			}
+			return m.Message
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.asm")
+	if err := ioutil.WriteFile(path, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reqR, reqW := io.Pipe()
+	resR, resW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(reqR, resW)
+		resW.Close()
+	}()
+	cl := &client{t: t, w: reqW, r: bufio.NewReader(resR)}
+
+	cl.call("initialize", map[string]string{"adapterID": "chip8"}, nil)
+	cl.send("launch", map[string]interface{}{"program": path})
+	var launch message
+	b, err := readMessage(cl.r)
+	if err == nil {
+		err = json.Unmarshal(b, &launch)
+	}
+	if err != nil || launch.Type != "response" || launch.Command != "launch" || !launch.Success {
+		t.Fatalf("the launch response should come before the initialized event, actual: %s %v", b, err)
+	}
+	cl.expect("event", "initialized", nil)
+
+	var breakpoints struct {
+		Breakpoints []breakpoint `json:"breakpoints"`
+	}
+	cl.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": path},
+		"breakpoints": []map[string]int{{"line": 5}, {"line": 7}, {"line": 20}},
+	}, &breakpoints)
+	expected := []breakpoint{
+		{Verified: true, Line: 5, InstructionReference: "0x0204"},
+		{Verified: true, Line: 9, InstructionReference: "0x0208"},
+		{Verified: false, Line: 20},
+	}
+	for i, b := range breakpoints.Breakpoints {
+		if b.Verified != expected[i].Verified || b.Line != expected[i].Line || b.InstructionReference != expected[i].InstructionReference {
+			t.Errorf("breakpoint %d should be %+v, actual: %+v", i, expected[i], b)
+		}
+	}
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	cl.call("configurationDone", nil, nil)
+	cl.expect("event", "stopped", &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("the CPU should stop on a breakpoint, actual: %s", stopped.Reason)
+	}
+
+	var trace struct {
+		StackFrames []stackFrame `json:"stackFrames"`
+	}
+	cl.call("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[0].Line != 9 || trace.StackFrames[1].Line != 4 ||
+		trace.StackFrames[0].Source.Path != path || trace.StackFrames[1].InstructionPointerReference != "0x0202" {
+		t.Errorf("the stack should be at lines 9 and 4 of %s, actual: %+v", path, trace.StackFrames)
+	}
+
+	cl.call("next", map[string]int{"threadId": threadID}, nil)
+	cl.expect("event", "stopped", &stopped)
+	cl.call("stepOut", map[string]int{"threadId": threadID}, nil)
+	cl.expect("event", "stopped", &stopped)
+	if stopped.Reason != "step" {
+		t.Errorf("the CPU should stop after the step, actual: %s", stopped.Reason)
+	}
+
+	var variables struct {
+		Variables []variable `json:"variables"`
+	}
+	cl.call("variables", map[string]int{"variablesReference": registersRef}, &variables)
+	if v := variables.Variables; len(v) != 21 || v[1].Value != "0x10" || v[17].Name != "PC" || v[17].Value != "0x204" {
+		t.Errorf("V1 should be 0x10 and PC 0x204, actual: %+v", v)
+	}
+
+	var value struct {
+		Value string `json:"value"`
+	}
+	cl.call("setVariable", map[string]interface{}{"variablesReference": registersRef, "name": "V0", "value": "0x42"}, &value)
+	if value.Value != "0x42" {
+		t.Errorf("V0 should be set to 0x42, actual: %s", value.Value)
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	cl.call("evaluate", map[string]string{"expression": "v0"}, &result)
+	if result.Result != "0x42" {
+		t.Errorf("v0 should evaluate to 0x42, actual: %s", result.Result)
+	}
+	cl.call("evaluate", map[string]string{"expression": "mem 0x200 4"}, &result)
+	if result.Result != "0x0200  60 01 22 08" {
+		t.Errorf("the memory should be dumped, actual: %q", result.Result)
+	}
+
+	cl.call("writeMemory", map[string]string{"memoryReference": "0x0300", "data": "AQID"}, nil)
+	var memory struct {
+		Address string `json:"address"`
+		Data    string `json:"data"`
+	}
+	cl.call("readMemory", map[string]interface{}{"memoryReference": "0x02FF", "offset": 1, "count": 3}, &memory)
+	if memory.Address != "0x0300" || memory.Data != "AQID" {
+		t.Errorf("the memory should be read back, actual: %+v", memory)
+	}
+
+	cl.call("readMemory", map[string]interface{}{"memoryReference": "0xFFFE", "count": 0x7FFFFFFF}, &memory)
+	if memory.Address != "0xFFFE" || memory.Data != "AAA=" {
+		t.Errorf("the last 2 bytes of the memory should be read, actual: %+v", memory)
+	}
+
+	if msg := cl.callFailing("readMemory", map[string]interface{}{"memoryReference": "0x0200", "count": -1}); msg != "invalid count -1" {
+		t.Errorf("a negative count should fail, actual: %q", msg)
+	}
+
+	var disassembly struct {
+		Instructions []instruction `json:"instructions"`
+	}
+	cl.call("disassemble", map[string]interface{}{"memoryReference": "0x0204", "instructionOffset": -1, "instructionCount": 2}, &disassembly)
+	if d := disassembly.Instructions; len(d) != 2 || d[0].Instruction != "CALL 0x208" || d[0].Line != 4 || d[1].Address != "0x0204" {
+		t.Errorf("the instructions around 0x204 should be disassembled, actual: %+v", d)
+	}
+
+	cl.call("continue", map[string]int{"threadId": threadID}, nil)
+	cl.expect("event", "exited", nil)
+	cl.expect("event", "terminated", nil)
+	cl.call("disconnect", nil, nil)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// ADD V0, 0x01 then JP 0x200 loops forever without being stuck on an address
+	path := filepath.Join(dir, "loop.ch8")
+	if err := ioutil.WriteFile(path, []byte{0x70, 0x01, 0x12, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reqR, reqW := io.Pipe()
+	resR, resW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(reqR, resW)
+		resW.Close()
+	}()
+	cl := &client{t: t, w: reqW, r: bufio.NewReader(resR)}
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	cl.call("initialize", nil, nil)
+	cl.call("launch", map[string]interface{}{"program": path, "stopOnEntry": true}, nil)
+	cl.call("configurationDone", nil, nil)
+	cl.expect("event", "stopped", &stopped)
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	cl.call("evaluate", map[string]string{"expression": "step 3"}, &result)
+	cl.expect("event", "stopped", &stopped)
+	cl.call("evaluate", map[string]string{"expression": "regs"}, &result)
+	if stopped.Reason != "step" || !strings.Contains(result.Result, "V0=02 ") || !strings.Contains(result.Result, "PC=0202") {
+		t.Errorf("step 3 should stop at 0x202 with V0 = 2, actual: %s %q", stopped.Reason, result.Result)
+	}
+
+	// continue keeps reading the requests, and can be paused
+	cl.call("evaluate", map[string]string{"expression": "c"}, nil)
+	cl.call("pause", map[string]int{"threadId": threadID}, nil)
+	cl.expect("event", "stopped", &stopped)
+	if stopped.Reason != "pause" {
+		t.Errorf("the CPU should be paused, actual: %s", stopped.Reason)
+	}
+
+	// and stops on the breakpoints of the session
+	cl.call("setInstructionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"instructionReference": "0x0202"}},
+	}, nil)
+	cl.call("evaluate", map[string]string{"expression": "continue"}, nil)
+	cl.expect("event", "stopped", &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("the CPU should stop on the breakpoint, actual: %s", stopped.Reason)
+	}
+
+	for _, expression := range []string{"poke 0x300 1", "break 0x200", "quit", "step 0"} {
+		if msg := cl.callFailing("evaluate", map[string]string{"expression": expression}); msg == "" {
+			t.Errorf("%s should fail", expression)
+		}
+	}
+
+	cl.call("disconnect", nil, nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	reqR, reqW := io.Pipe()
+	resR, resW := io.Pipe()
+	go Serve(reqR, resW)
+	cl := &client{t: t, w: reqW, r: bufio.NewReader(resR)}
+
+	tc := []struct {
+		command   string
+		arguments interface{}
+		message   string
+	}{
+		{"stackTrace", nil, "no program is launched"},
+		{"launch", map[string]string{}, "missing program"},
+		{"launch", map[string]string{"program": "missing.ch8", "quirks": "foo"}, "open"},
+		{"foo", nil, "unsupported request foo"},
+	}
+
+	for _, c := range tc {
+		if msg := cl.callFailing(c.command, c.arguments); !strings.HasPrefix(msg, c.message) {
+			t.Errorf("%s should fail with %q, actual: %q", c.command, c.message, msg)
+		}
+	}
+	reqW.Close()
+}
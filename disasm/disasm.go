@@ -0,0 +1,285 @@
+// Package disasm decodes CHIP-8, SUPER-CHIP and XO-CHIP programs into the mnemonics of Cowgod's Chip-8 Technical Reference.
+//
+// The operands are written V0 to VF for the registers, 0x followed by 3 hex digits for the addresses, 2 for the bytes and 4
+// for the 16 bits addresses, and in decimal for the nibbles. The bytes which are not code are written as db directives.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Flow describes how an instruction continues the execution.
+type Flow int
+
+const (
+	Next     Flow = iota // the next instruction
+	Skip                 // the next instruction, or the one after it
+	Jump                 // Target only
+	Call                 // Target, then the next instruction once the subroutine returns
+	Return               // the address at the top of the stack
+	Indirect             // an address computed at run time (JP V0, addr)
+	Stop                 // nothing, the program exits
+)
+
+// An Instruction is a decoded opcode, or data when Valid is false.
+type Instruction struct {
+	Addr     rune
+	Bytes    []byte // 2 bytes, 4 for F000 nnnn, or the bytes of the data
+	Mnemonic string
+	Valid    bool
+	Flow     Flow
+	Target   rune // destination of Jump and Call
+}
+
+// Size returns the number of bytes of the instruction.
+func (in Instruction) Size() int {
+	return len(in.Bytes)
+}
+
+// String returns the address, the bytes in hex and the mnemonic.
+func (in Instruction) String() string {
+	return fmt.Sprintf("0x%03X  %-16X  %s", in.Addr, in.Bytes, in.Mnemonic)
+}
+
+// Decode decodes the instruction at the start of b, loaded at addr. When b doesn't start with a valid instruction, the
+// returned instruction holds its first 2 bytes as data.
+func Decode(b []byte, addr rune) Instruction {
+	if len(b) < 2 {
+		return Data(b, addr)
+	}
+
+	opcode := rune(b[0])<<8 | rune(b[1])
+	x := byte(opcode>>8) & 0x0F
+	y := byte(opcode>>4) & 0x0F
+	n := byte(opcode) & 0x0F
+	kk := byte(opcode)
+	nnn := opcode & 0x0FFF
+
+	in := Instruction{Addr: addr, Bytes: b[:2], Valid: true, Flow: Next}
+	set := func(format string, a ...interface{}) {
+		in.Mnemonic = fmt.Sprintf(format, a...)
+	}
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		switch {
+		case opcode&0xFFF0 == 0x00C0:
+			set("SCD %d", n)
+		case opcode&0xFFF0 == 0x00D0:
+			set("SCU %d", n)
+		case opcode == 0x00E0:
+			set("CLS")
+		case opcode == 0x00EE:
+			set("RET")
+			in.Flow = Return
+		case opcode == 0x00FB:
+			set("SCR")
+		case opcode == 0x00FC:
+			set("SCL")
+		case opcode == 0x00FD:
+			set("EXIT")
+			in.Flow = Stop
+		case opcode == 0x00FE:
+			set("LOW")
+		case opcode == 0x00FF:
+			set("HIGH")
+		default:
+			in.Valid = false
+		}
+	case 0x1000:
+		set("JP 0x%03X", nnn)
+		in.Flow, in.Target = Jump, nnn
+	case 0x2000:
+		set("CALL 0x%03X", nnn)
+		in.Flow, in.Target = Call, nnn
+	case 0x3000:
+		set("SE V%X, 0x%02X", x, kk)
+		in.Flow = Skip
+	case 0x4000:
+		set("SNE V%X, 0x%02X", x, kk)
+		in.Flow = Skip
+	case 0x5000:
+		switch n {
+		case 0x0:
+			set("SE V%X, V%X", x, y)
+			in.Flow = Skip
+		case 0x2:
+			set("LD [I], V%X - V%X", x, y)
+		case 0x3:
+			set("LD V%X - V%X, [I]", x, y)
+		default:
+			in.Valid = false
+		}
+	case 0x6000:
+		set("LD V%X, 0x%02X", x, kk)
+	case 0x7000:
+		set("ADD V%X, 0x%02X", x, kk)
+	case 0x8000:
+		names := map[byte]string{
+			0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD", 0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL",
+		}
+		if name, ok := names[n]; ok {
+			set("%s V%X, V%X", name, x, y)
+		} else {
+			in.Valid = false
+		}
+	case 0x9000:
+		if n == 0x0 {
+			set("SNE V%X, V%X", x, y)
+			in.Flow = Skip
+		} else {
+			in.Valid = false
+		}
+	case 0xA000:
+		set("LD I, 0x%03X", nnn)
+	case 0xB000:
+		set("JP V0, 0x%03X", nnn)
+		in.Flow = Indirect
+	case 0xC000:
+		set("RND V%X, 0x%02X", x, kk)
+	case 0xD000:
+		set("DRW V%X, V%X, %d", x, y, n)
+	case 0xE000:
+		switch kk {
+		case 0x9E:
+			set("SKP V%X", x)
+			in.Flow = Skip
+		case 0xA1:
+			set("SKNP V%X", x)
+			in.Flow = Skip
+		default:
+			in.Valid = false
+		}
+	case 0xF000:
+		formats := map[byte]string{
+			0x07: "LD V%X, DT",
+			0x0A: "LD V%X, K",
+			0x15: "LD DT, V%X",
+			0x18: "LD ST, V%X",
+			0x1E: "ADD I, V%X",
+			0x29: "LD F, V%X",
+			0x30: "LD HF, V%X",
+			0x33: "LD B, V%X",
+			0x3A: "PITCH V%X",
+			0x55: "LD [I], V%X",
+			0x65: "LD V%X, [I]",
+			0x75: "LD R, V%X",
+			0x85: "LD V%X, R",
+		}
+		switch {
+		case opcode == 0xF000:
+			if len(b) < 4 {
+				in.Valid = false
+				break
+			}
+			in.Bytes = b[:4]
+			set("LD I, LONG 0x%04X", rune(b[2])<<8|rune(b[3]))
+		case kk == 0x01:
+			set("PLANE %d", x)
+		case opcode == 0xF002:
+			set("AUDIO")
+		case formats[kk] != "":
+			set(formats[kk], x)
+		default:
+			in.Valid = false
+		}
+	}
+
+	if !in.Valid {
+		return Data(b[:2], addr)
+	}
+
+	return in
+}
+
+// Data returns the bytes as a db directive.
+func Data(b []byte, addr rune) Instruction {
+	var m bytes.Buffer
+	m.WriteString("db")
+	for i, v := range b {
+		if i > 0 {
+			m.WriteString(",")
+		}
+		fmt.Fprintf(&m, " 0x%02X", v)
+	}
+
+	return Instruction{Addr: addr, Bytes: b, Mnemonic: m.String(), Flow: Stop}
+}
+
+// Disassemble decodes the whole program, loaded at origin, as a sequence of instructions.
+func Disassemble(program []byte, origin rune) []Instruction {
+	var out []Instruction
+	for i := 0; i < len(program); {
+		in := Decode(program[i:], origin+rune(i))
+		out = append(out, in)
+		i += in.Size()
+	}
+
+	return out
+}
+
+// dataLine is the maximum number of bytes of a db directive written by Follow.
+const dataLine = 8
+
+// Follow decodes the program, loaded at origin, following the control flow from origin. Only the reachable instructions are
+// decoded as code, the other bytes are written as data. The targets of JP V0, addr are unknown, the code they reach is
+// written as data.
+func Follow(program []byte, origin rune) []Instruction {
+	code := make(map[int]Instruction)
+	todo := []rune{origin}
+	for len(todo) > 0 {
+		addr := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+
+		i := int(addr - origin)
+		if i < 0 || i >= len(program) {
+			continue
+		}
+		if _, seen := code[i]; seen {
+			continue
+		}
+
+		in := Decode(program[i:], addr)
+		if !in.Valid {
+			continue
+		}
+		code[i] = in
+
+		next := addr + rune(in.Size())
+		switch in.Flow {
+		case Next:
+			todo = append(todo, next)
+		case Skip:
+			todo = append(todo, next)
+			if j := int(next - origin); j >= 0 && j < len(program) {
+				todo = append(todo, next+rune(Decode(program[j:], next).Size()))
+			}
+		case Jump:
+			todo = append(todo, in.Target)
+		case Call:
+			todo = append(todo, in.Target, next)
+		}
+	}
+
+	var out []Instruction
+	for i := 0; i < len(program); {
+		if in, ok := code[i]; ok {
+			out = append(out, in)
+			i += in.Size()
+			continue
+		}
+
+		j := i + 1
+		for j < len(program) && j-i < dataLine {
+			if _, ok := code[j]; ok {
+				break
+			}
+			j++
+		}
+		out = append(out, Data(program[i:j], origin+rune(i)))
+		i = j
+	}
+
+	return out
+}
@@ -0,0 +1,100 @@
+package disasm
+
+import (
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tc := []struct {
+		b        []byte
+		mnemonic string
+		flow     Flow
+	}{
+		{[]byte{0x00, 0xC4}, "SCD 4", Next},
+		{[]byte{0x00, 0xD2}, "SCU 2", Next},
+		{[]byte{0x00, 0xE0}, "CLS", Next},
+		{[]byte{0x00, 0xEE}, "RET", Return},
+		{[]byte{0x00, 0xFD}, "EXIT", Stop},
+		{[]byte{0x00, 0xFF}, "HIGH", Next},
+		{[]byte{0x12, 0x34}, "JP 0x234", Jump},
+		{[]byte{0x22, 0x34}, "CALL 0x234", Call},
+		{[]byte{0x3A, 0x0F}, "SE VA, 0x0F", Skip},
+		{[]byte{0x51, 0x20}, "SE V1, V2", Skip},
+		{[]byte{0x51, 0x32}, "LD [I], V1 - V3", Next},
+		{[]byte{0x51, 0x33}, "LD V1 - V3, [I]", Next},
+		{[]byte{0x6B, 0xFF}, "LD VB, 0xFF", Next},
+		{[]byte{0x81, 0x26}, "SHR V1, V2", Next},
+		{[]byte{0x81, 0x2E}, "SHL V1, V2", Next},
+		{[]byte{0x9E, 0xF0}, "SNE VE, VF", Skip},
+		{[]byte{0xA2, 0x1A}, "LD I, 0x21A", Next},
+		{[]byte{0xB3, 0x00}, "JP V0, 0x300", Indirect},
+		{[]byte{0xC0, 0x1F}, "RND V0, 0x1F", Next},
+		{[]byte{0xD1, 0x2F}, "DRW V1, V2, 15", Next},
+		{[]byte{0xE5, 0x9E}, "SKP V5", Skip},
+		{[]byte{0xE5, 0xA1}, "SKNP V5", Skip},
+		{[]byte{0xF0, 0x00, 0x12, 0x34}, "LD I, LONG 0x1234", Next},
+		{[]byte{0xF3, 0x01}, "PLANE 3", Next},
+		{[]byte{0xF0, 0x02}, "AUDIO", Next},
+		{[]byte{0xF2, 0x0A}, "LD V2, K", Next},
+		{[]byte{0xF2, 0x30}, "LD HF, V2", Next},
+		{[]byte{0xF2, 0x3A}, "PITCH V2", Next},
+		{[]byte{0xF2, 0x65}, "LD V2, [I]", Next},
+		{[]byte{0xF2, 0x85}, "LD V2, R", Next},
+		{[]byte{0x01, 0x23}, "db 0x01, 0x23", Stop},
+		{[]byte{0x81, 0x28}, "db 0x81, 0x28", Stop},
+		{[]byte{0xF1, 0x00}, "db 0xF1, 0x00", Stop},
+		{[]byte{0xF0, 0x00}, "db 0xF0, 0x00", Stop},
+		{[]byte{0xAB}, "db 0xAB", Stop},
+	}
+
+	for _, c := range tc {
+		in := Decode(c.b, 0x200)
+		if in.Mnemonic != c.mnemonic || in.Flow != c.flow {
+			t.Errorf("% X should decode to %q (flow %d), actual: %q (flow %d)\n", c.b, c.mnemonic, c.flow, in.Mnemonic, in.Flow)
+		}
+
+		if in.Size() != len(c.b) {
+			t.Errorf("% X should be %d bytes, actual: %d\n", c.b, len(c.b), in.Size())
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	program := []byte{
+		0x22, 0x08, // 0x200 CALL 0x208
+		0x12, 0x0C, // 0x202 JP 0x20C
+		0x00, 0xE0, // 0x204 data which looks like CLS
+		0xFF, 0xFF, // 0x206 data
+		0x3A, 0x01, // 0x208 SE VA, 0x01
+		0x00, 0xEE, // 0x20A RET
+		0x12, 0x0C, // 0x20C JP 0x20C
+	}
+
+	expected := []string{
+		"CALL 0x208",
+		"JP 0x20C",
+		"db 0x00, 0xE0, 0xFF, 0xFF",
+		"SE VA, 0x01",
+		"RET",
+		"JP 0x20C",
+	}
+
+	out := Follow(program, 0x200)
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d lines, actual: %v\n", len(expected), out)
+	}
+
+	for i, in := range out {
+		if in.Mnemonic != expected[i] {
+			t.Errorf("line %d should be %q, actual: %q\n", i, expected[i], in.Mnemonic)
+		}
+	}
+
+	if out[2].Addr != 0x204 || out[3].Addr != 0x208 {
+		t.Errorf("data should start at 0x204 and code resume at 0x208, actual: 0x%03X, 0x%03X\n", out[2].Addr, out[3].Addr)
+	}
+
+	if linear := Disassemble(program, 0x200); linear[2].Mnemonic != "CLS" {
+		t.Errorf("linear disassembly should decode 0x204 as CLS, actual: %q\n", linear[2].Mnemonic)
+	}
+}
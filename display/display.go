@@ -1,16 +1,17 @@
 package display
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
-	"github.com/veandco/go-sdl2/sdl"
-	"log"
 )
 
 const (
-	X             int    = 64
-	Y             int    = 32
-	activeColor   uint32 = 0xFFFFFFF
-	inactiveColor uint32 = 0x000000
+	X int = 64 // width of the low resolution mode
+	Y int = 32 // height of the low resolution mode
+
+	HighResX int = 128 // width of the SUPER-CHIP high resolution mode
+	HighResY int = 64  // height of the SUPER-CHIP high resolution mode
 )
 
 var Sprites map[byte][5]byte = map[byte][5]byte{
@@ -51,108 +52,260 @@ var SpritesAddresses map[byte]rune = map[byte]rune{
 	0x0F: 0x004B,
 }
 
+// BigSprites is the SUPER-CHIP 8x10 font.
+var BigSprites map[byte][10]byte = map[byte][10]byte{
+	0x00: {0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C}, // "0"
+	0x01: {0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C}, // "1"
+	0x02: {0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF}, // "2"
+	0x03: {0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C}, // "3"
+	0x04: {0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06}, // "4"
+	0x05: {0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C}, // "5"
+	0x06: {0x3E, 0x7C, 0xE0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C}, // "6"
+	0x07: {0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60}, // "7"
+	0x08: {0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C}, // "8"
+	0x09: {0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C}, // "9"
+	0x0A: {0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3}, // "A"
+	0x0B: {0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC}, // "B"
+	0x0C: {0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C}, // "C"
+	0x0D: {0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC}, // "D"
+	0x0E: {0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF}, // "E"
+	0x0F: {0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0}, // "F"
+}
+
+// BigSpritesAddresses are the locations of the big font, loaded right after the small one.
+var BigSpritesAddresses map[byte]rune = map[byte]rune{
+	0x00: 0x0050,
+	0x01: 0x005A,
+	0x02: 0x0064,
+	0x03: 0x006E,
+	0x04: 0x0078,
+	0x05: 0x0082,
+	0x06: 0x008C,
+	0x07: 0x0096,
+	0x08: 0x00A0,
+	0x09: 0x00AA,
+	0x0A: 0x00B4,
+	0x0B: 0x00BE,
+	0x0C: 0x00C8,
+	0x0D: 0x00D2,
+	0x0E: 0x00DC,
+	0x0F: 0x00E6,
+}
+
+// A Sprite is a bitmap of Width pixels per row, each row being stored on Width/8 bytes. A zero Width means 8.
 type Sprite struct {
 	Cells []byte
+	Width int
 }
 
 type Display struct {
-	Cells   [][]byte
-	Window  *sdl.Window
-	Surface *sdl.Surface
-}
+	Cells    [][]byte
+	Renderer Renderer // defaults to a NullRenderer when nil
 
-func (d *Display) Reset() {
-	var err error
+	HighRes bool // SUPER-CHIP 128x64 mode
+	Plane   byte // XO-CHIP bitplanes affected by drawing, clearing and scrolling, 1 and 2 being the first and second planes
+
+	generation uint64
+}
 
-	if err = sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		log.Panicln(err)
+func (d *Display) Reset() error {
+	if d.Renderer == nil {
+		d.Renderer = NullRenderer{}
 	}
 
-	d.Window, err = sdl.CreateWindow("go chip8", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, X*10, Y*10, sdl.WINDOW_SHOWN)
-	if err != nil {
-		log.Panicln(err)
+	if err := d.Renderer.Init(X, Y); err != nil {
+		return err
 	}
 
-	d.Surface, err = d.Window.GetSurface()
-	if err != nil {
-		log.Panicln(err)
+	d.Plane = 0x01
+	return d.SetHighRes(false)
+}
+
+// SetHighRes switches between the 64x32 and the 128x64 modes. Every plane of the framebuffer is cleared.
+func (d *Display) SetHighRes(on bool) error {
+	d.HighRes = on
+
+	w, h := X, Y
+	if on {
+		w, h = HighResX, HighResY
 	}
 
-	d.Cells = make([][]byte, Y)
+	d.Cells = make([][]byte, h)
 	for i := range d.Cells {
-		d.Cells[i] = make([]byte, X)
+		d.Cells[i] = make([]byte, w)
+	}
+
+	return d.Clear()
+}
+
+// Width returns the number of columns of the framebuffer.
+func (d *Display) Width() int {
+	if len(d.Cells) == 0 {
+		return 0
 	}
 
-	d.Clear()
+	return len(d.Cells[0])
 }
 
-func (d *Display) Clear() {
+// Height returns the number of rows of the framebuffer.
+func (d *Display) Height() int {
+	return len(d.Cells)
+}
+
+// Clear blanks the selected planes.
+func (d *Display) Clear() error {
 	for y := range d.Cells {
 		for x := range d.Cells[y] {
-			d.Cells[y][x] = 0
+			d.Cells[y][x] &^= d.Plane
 		}
 	}
 
-	d.draw()
+	return d.draw()
+}
+
+// Hash returns the hex encoded SHA-1 of the framebuffer, rows first.
+func (d *Display) Hash() string {
+	h := sha1.New()
+	for y := range d.Cells {
+		h.Write(d.Cells[y])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func (d *Display) DrawSprite(x, y int, s Sprite) (bool, error) {
+// Planes returns the number of selected planes.
+func (d *Display) Planes() int {
+	n := 0
+	for p := byte(0x01); p <= 0x02; p <<= 1 {
+		if d.Plane&p != 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// DrawSprite XORs the sprite onto the framebuffer at (x, y) and reports whether any pixel was erased. The starting position
+// wraps around the screen, then the pixels crossing an edge either wrap around to the opposite side or are clipped.
+//
+// When several planes are selected, the sprite holds the data of each plane one after the other, starting with the first plane.
+func (d *Display) DrawSprite(x, y int, s Sprite, clip bool) (bool, error) {
+	w, h := d.Width(), d.Height()
+	x %= w
+	y %= h
+
+	width := s.Width
+	if width == 0 {
+		width = 8
+	}
+	stride := (width + 7) / 8
+
+	planes := d.Planes()
+	if planes == 0 {
+		return false, nil
+	}
+	rows := len(s.Cells) / stride / planes
+
 	coll := false
-	for iy := 0; iy < len(s.Cells); iy++ {
-		barr := [8]byte{
-			(s.Cells[iy] & 0x80) >> 7,
-			(s.Cells[iy] & 0x40) >> 6,
-			(s.Cells[iy] & 0x20) >> 5,
-			(s.Cells[iy] & 0x10) >> 4,
-			(s.Cells[iy] & 0x08) >> 3,
-			(s.Cells[iy] & 0x04) >> 2,
-			(s.Cells[iy] & 0x02) >> 1,
-			(s.Cells[iy] & 0x01),
+	offset := 0
+	for plane := byte(0x01); plane <= 0x02; plane <<= 1 {
+		if d.Plane&plane == 0 {
+			continue
 		}
 
-		for ix := 0; ix < len(barr); ix++ {
-			c, err := d.setPixel((x+ix)%X, (y+iy)%Y, barr[ix])
-			if err != nil {
-				return false, err
+		for iy := 0; iy < rows; iy++ {
+			if clip && y+iy >= h {
+				break
 			}
 
-			if c == true {
-				coll = true
+			for ix := 0; ix < width; ix++ {
+				if clip && x+ix >= w {
+					break
+				}
+
+				b := (s.Cells[offset+iy*stride+ix/8] >> uint(7-ix%8)) & 0x01
+				c, err := d.setPixel((x+ix)%w, (y+iy)%h, b, plane)
+				if err != nil {
+					return false, err
+				}
+
+				if c == true {
+					coll = true
+				}
 			}
 		}
+		offset += rows * stride
 	}
 
-	d.draw()
-	return coll, nil
+	return coll, d.draw()
+}
+
+// ScrollUp moves the selected planes n rows up, the rows entering the screen are blank.
+func (d *Display) ScrollUp(n int) error {
+	return d.scroll(0, -n)
 }
 
-func (d *Display) setPixel(x, y int, b byte) (bool, error) {
+// ScrollDown moves the selected planes n rows down, the rows entering the screen are blank.
+func (d *Display) ScrollDown(n int) error {
+	return d.scroll(0, n)
+}
+
+// ScrollLeft moves the selected planes n columns to the left, the columns entering the screen are blank.
+func (d *Display) ScrollLeft(n int) error {
+	return d.scroll(-n, 0)
+}
+
+// ScrollRight moves the selected planes n columns to the right, the columns entering the screen are blank.
+func (d *Display) ScrollRight(n int) error {
+	return d.scroll(n, 0)
+}
+
+func (d *Display) scroll(dx, dy int) error {
+	w, h := d.Width(), d.Height()
+	cells := make([][]byte, h)
+	for y := range cells {
+		cells[y] = make([]byte, w)
+		for x := range cells[y] {
+			cells[y][x] = d.Cells[y][x] &^ d.Plane
+
+			sx, sy := x-dx, y-dy
+			if sx < 0 || sx >= w || sy < 0 || sy >= h {
+				continue
+			}
+			cells[y][x] |= d.Cells[sy][sx] & d.Plane
+		}
+	}
+
+	d.Cells = cells
+	return d.draw()
+}
+
+func (d *Display) setPixel(x, y int, b byte, plane byte) (bool, error) {
 	if y < 0 || y > len(d.Cells)-1 || x < 0 || x > len(d.Cells[0])-1 {
-		return false, fmt.Errorf("(%d, %d) out of range of display\n", x, y)
+		return false, fmt.Errorf("(%d, %d) out of range of display", x, y)
 	}
 
-	coll := false
-	if d.Cells[y][x] == 1 && b == 1 {
-		coll = true
+	if b == 0 {
+		return false, nil
 	}
 
-	d.Cells[y][x] = d.Cells[y][x] ^ b
+	coll := d.Cells[y][x]&plane != 0
+	d.Cells[y][x] = d.Cells[y][x] ^ plane
 	return coll, nil
 }
 
-func (d *Display) draw() {
-	for y := range d.Cells {
-		for x := range d.Cells[y] {
-			var color uint32
-			if d.Cells[y][x] == 1 {
-				color = activeColor
-			} else {
-				color = inactiveColor
-			}
-			rect := &sdl.Rect{int32(x) * 10, int32(y) * 10, 10, 10}
-			d.Surface.FillRect(rect, color)
-		}
-	}
+// Redraw sends the framebuffer to the renderer, after Cells was modified directly.
+func (d *Display) Redraw() error {
+	return d.draw()
+}
+
+// Generation returns a counter incremented each time the framebuffer is drawn.
+func (d *Display) Generation() uint64 {
+	return d.generation
+}
 
-	d.Window.UpdateSurface()
+// draw sends the framebuffer to the renderer and returns its error.
+func (d *Display) draw() error {
+	d.generation++
+	return d.Renderer.Draw(d.Cells)
 }
@@ -1 +1,69 @@
 package display
+
+import "testing"
+
+func TestReset(t *testing.T) {
+	d := &Display{}
+	d.Reset()
+
+	if _, ok := d.Renderer.(NullRenderer); !ok {
+		t.Errorf("renderer should default to NullRenderer, got %T", d.Renderer)
+	}
+
+	if len(d.Cells) != Y || len(d.Cells[0]) != X {
+		t.Errorf("framebuffer should be %dx%d, got %dx%d", X, Y, len(d.Cells[0]), len(d.Cells))
+	}
+}
+
+func TestDrawSprite(t *testing.T) {
+	r := new(FramebufferRenderer)
+	d := &Display{Renderer: r}
+	d.Reset()
+
+	coll, err := d.DrawSprite(X-4, 0, Sprite{Cells: []byte{0xFF}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if coll {
+		t.Error("drawing on a blank display should not collide")
+	}
+
+	for _, x := range []int{X - 4, X - 1, 0, 3} {
+		if r.Cells[0][x] != 1 {
+			t.Errorf("pixel (%d, 0) should be set", x)
+		}
+	}
+
+	coll, _ = d.DrawSprite(X-4, 0, Sprite{Cells: []byte{0x80}}, false)
+	if !coll {
+		t.Error("drawing over a set pixel should collide")
+	}
+
+	if r.Cells[0][X-4] != 0 {
+		t.Error("pixel should have been erased")
+	}
+}
+
+func TestDrawSpriteClip(t *testing.T) {
+	r := new(FramebufferRenderer)
+	d := &Display{Renderer: r}
+	d.Reset()
+
+	if _, err := d.DrawSprite(X+X-4, Y-1, Sprite{Cells: []byte{0xFF, 0xFF}}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for y := range r.Cells {
+		for x := range r.Cells[y] {
+			expected := byte(0)
+			if y == Y-1 && x >= X-4 {
+				expected = 1
+			}
+
+			if r.Cells[y][x] != expected {
+				t.Errorf("pixel (%d, %d) should be %d, got %d", x, y, expected, r.Cells[y][x])
+			}
+		}
+	}
+}
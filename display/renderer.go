@@ -0,0 +1,50 @@
+package display
+
+// A Renderer presents the content of the display framebuffer.
+//
+// Init is called once by Display.Reset with the size of the framebuffer, then Draw is called each time the framebuffer changes.
+// Cells is indexed as cells[y][x] and must not be retained by the renderer. Each cell holds the XO-CHIP planes set at that
+// position, bit 0 being the first plane, so a cell value is one of the 4 colours 0 to 3.
+type Renderer interface {
+	Init(width, height int) error
+	Draw(cells [][]byte) error
+}
+
+// NullRenderer discards every frame.
+type NullRenderer struct{}
+
+func (NullRenderer) Init(width, height int) error { return nil }
+
+func (NullRenderer) Draw(cells [][]byte) error { return nil }
+
+// FramebufferRenderer keeps a copy of the last drawn frame in memory.
+type FramebufferRenderer struct {
+	Cells  [][]byte
+	Frames int // number of frames drawn since Init
+}
+
+func (r *FramebufferRenderer) Init(width, height int) error {
+	r.Cells = make([][]byte, height)
+	for i := range r.Cells {
+		r.Cells[i] = make([]byte, width)
+	}
+	r.Frames = 0
+
+	return nil
+}
+
+func (r *FramebufferRenderer) Draw(cells [][]byte) error {
+	if len(r.Cells) != len(cells) || (len(cells) > 0 && len(r.Cells[0]) != len(cells[0])) {
+		r.Cells = make([][]byte, len(cells))
+		for i := range r.Cells {
+			r.Cells[i] = make([]byte, len(cells[i]))
+		}
+	}
+
+	for y := range cells {
+		copy(r.Cells[y], cells[y])
+	}
+	r.Frames++
+
+	return nil
+}
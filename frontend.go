@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/keyboard"
+	"github.com/jordanabderrachid/go-chip8/rewind"
+	"github.com/jordanabderrachid/go-chip8/timer"
+	"github.com/veandco/go-sdl2/sdl"
+	"os"
+	"time"
+)
+
+// runWindowed runs one frame on each tick of the timers and handles the SDL events between the frames, until the window is
+// closed or an instruction fails.
+//
+// Hotkeys:
+//
+//	minus      decrease the number of instructions per frame
+//	equals     increase the number of instructions per frame
+//	F5         save the machine state to statePath
+//	F9         load the machine state from statePath
+//	backspace  step backwards in time while held, through the snapshots of history
+//	escape     quit
+//
+// While a movie is recorded, the speed can't be changed and no state can be loaded, as the replay wouldn't follow. A nil
+// history disables the rewind.
+func runWindowed(c *cpu.CPU, statePath string, recording bool, history *rewind.Buffer) error {
+	ticker := time.NewTicker(time.Duration(int64(time.Second) / timer.Frenquency))
+	defer ticker.Stop()
+
+	rewinding := false
+	for range ticker.C {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch e := event.(type) {
+			case *sdl.QuitEvent:
+				return nil
+			case *sdl.KeyDownEvent:
+				switch e.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return nil
+				case sdl.K_MINUS, sdl.K_EQUALS, sdl.K_F9:
+					if recording {
+						fmt.Fprintln(os.Stderr, "disabled while recording a movie")
+						break
+					}
+
+					switch e.Keysym.Sym {
+					case sdl.K_MINUS:
+						setSpeed(c, c.Speed()-1)
+					case sdl.K_EQUALS:
+						setSpeed(c, c.Speed()+1)
+					case sdl.K_F9:
+						if err := loadState(c, statePath); err != nil {
+							fmt.Fprintln(os.Stderr, err)
+						}
+					}
+				case sdl.K_F5:
+					if err := saveState(c, statePath); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+					}
+				case sdl.K_BACKSPACE:
+					rewinding = history != nil
+				}
+			case *sdl.KeyUpEvent:
+				if e.Keysym.Sym == sdl.K_BACKSPACE {
+					rewinding = false
+				}
+			}
+		}
+
+		if rewinding {
+			if _, err := history.Rewind(c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := c.RunFrame(); err != nil {
+			return err
+		}
+
+		if history != nil {
+			if err := history.Frame(c); err != nil {
+				return err
+			}
+		}
+
+		if c.Exited {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func setSpeed(c *cpu.CPU, n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	c.CyclesPerFrame = n
+	fmt.Fprintf(os.Stderr, "speed: %d instructions per frame (%d per second)\n", n, int64(n)*timer.Frenquency)
+}
+
+func saveState(c *cpu.CPU, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := c.SaveState(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "state saved to %s\n", path)
+	return nil
+}
+
+func loadState(c *cpu.CPU, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.LoadState(bufio.NewReader(f))
+}
+
+// keyboardSource returns the SDL keyboard source bound with the preset selected for the ROM.
+func keyboardSource(preset, file, rom string) (keyboard.Source, error) {
+	var config *keyboard.Config
+	if file != "" {
+		var err error
+		if config, err = keyboard.LoadConfig(file); err != nil {
+			return nil, err
+		}
+	}
+
+	binding, err := config.Binding(preset, rom)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSDLSource(binding)
+}
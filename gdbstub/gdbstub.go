@@ -0,0 +1,581 @@
+// Package gdbstub exposes a CPU to GDB through the remote serial protocol.
+//
+// The registers are V0 to VF, I, PC, SP, DT and ST, numbered from 0 to 20 and described to GDB by target.xml. I and PC are
+// 16 bits little-endian, the others are 8 bits. The memory is the 64KB of the XO-CHIP address space. The software and
+// hardware breakpoints are the same, the watchpoints are backed by cpu.Watch.
+package gdbstub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/mmu"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// interrupt is the byte sent by GDB to stop a running target, on Ctrl-C.
+const interrupt = 0x03
+
+// pollInterval is the number of instructions executed by continue between two checks for an interrupt.
+const pollInterval = 1000
+
+// targetXML describes the registers of the CPU.
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.chip8.cpu">
+    <reg name="v0" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="v1" bitsize="8" type="uint8"/>
+    <reg name="v2" bitsize="8" type="uint8"/>
+    <reg name="v3" bitsize="8" type="uint8"/>
+    <reg name="v4" bitsize="8" type="uint8"/>
+    <reg name="v5" bitsize="8" type="uint8"/>
+    <reg name="v6" bitsize="8" type="uint8"/>
+    <reg name="v7" bitsize="8" type="uint8"/>
+    <reg name="v8" bitsize="8" type="uint8"/>
+    <reg name="v9" bitsize="8" type="uint8"/>
+    <reg name="va" bitsize="8" type="uint8"/>
+    <reg name="vb" bitsize="8" type="uint8"/>
+    <reg name="vc" bitsize="8" type="uint8"/>
+    <reg name="vd" bitsize="8" type="uint8"/>
+    <reg name="ve" bitsize="8" type="uint8"/>
+    <reg name="vf" bitsize="8" type="uint8"/>
+    <reg name="i" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="dt" bitsize="8" type="uint8"/>
+    <reg name="st" bitsize="8" type="uint8"/>
+  </feature>
+</target>
+`
+
+// packetSize is the maximum size of the packets, advertised to GDB. The memory reads are limited to the half of it, each byte
+// being sent as 2 hex digits.
+const packetSize = 0x4000
+
+// registers is the number of registers known to GDB.
+const registers = 21
+
+// Server serves GDB sessions on the CPU, one at a time. The CPU must be reset, with its program loaded.
+type Server struct {
+	CPU *cpu.CPU
+}
+
+// ListenAndServe listens on the TCP address and serves the sessions until an error occurs.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		err = s.Serve(conn)
+		conn.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// Serve runs a session on the connection, until GDB detaches or kills the target, or the connection is closed.
+func (s *Server) Serve(conn io.ReadWriter) error {
+	ss := &session{
+		cpu:         s.CPU,
+		w:           conn,
+		in:          make(chan byte, 4096),
+		ack:         true,
+		breakpoints: make(map[rune]bool),
+		watches:     make(map[string]int),
+	}
+
+	// the connection is read in the background, to notice the interrupts while the CPU runs
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				ss.err = err
+				close(ss.in)
+				return
+			}
+
+			select {
+			case ss.in <- b:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		packet, err := ss.readPacket()
+		if err != nil {
+			return err
+		}
+
+		reply, stop := ss.handle(packet)
+		if err := ss.writePacket(reply); err != nil {
+			return err
+		}
+
+		if stop {
+			for _, id := range ss.watches {
+				s.CPU.Unwatch(id)
+			}
+			return nil
+		}
+	}
+}
+
+type session struct {
+	cpu *cpu.CPU
+	w   io.Writer
+	in  chan byte
+	err error // error of the reader, once in is closed
+
+	ack         bool // the packets are acknowledged, until QStartNoAckMode
+	last        string
+	breakpoints map[rune]bool
+	watches     map[string]int // ids of the watchpoints by Z packet
+}
+
+func (ss *session) readByte() (byte, error) {
+	b, ok := <-ss.in
+	if !ok {
+		return 0, ss.err
+	}
+
+	return b, nil
+}
+
+// readPacket returns the data of the next packet, acknowledging it.
+func (ss *session) readPacket() (string, error) {
+	for {
+		b, err := ss.readByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch b {
+		case '$':
+		case '-':
+			// the last reply was corrupted
+			if _, err := io.WriteString(ss.w, ss.last); err != nil {
+				return "", err
+			}
+			continue
+		case interrupt:
+			// the target isn't running, report it stopped
+			return "?", nil
+		default:
+			continue
+		}
+
+		var data bytes.Buffer
+		for {
+			b, err := ss.readByte()
+			if err != nil {
+				return "", err
+			}
+			if b == '#' {
+				break
+			}
+			data.WriteByte(b)
+		}
+
+		var sum [2]byte
+		for i := range sum {
+			if sum[i], err = ss.readByte(); err != nil {
+				return "", err
+			}
+		}
+
+		if !ss.ack {
+			return data.String(), nil
+		}
+
+		if fmt.Sprintf("%02x", checksum(data.Bytes())) != strings.ToLower(string(sum[:])) {
+			if _, err := io.WriteString(ss.w, "-"); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if _, err := io.WriteString(ss.w, "+"); err != nil {
+			return "", err
+		}
+
+		return data.String(), nil
+	}
+}
+
+func (ss *session) writePacket(data string) error {
+	ss.last = fmt.Sprintf("$%s#%02x", data, checksum([]byte(data)))
+	_, err := io.WriteString(ss.w, ss.last)
+	return err
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+
+	return sum
+}
+
+// handle executes a command, and reports whether the session is over.
+func (ss *session) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return "S05", false
+	case 'g':
+		var b bytes.Buffer
+		for n := 0; n < registers; n++ {
+			b.WriteString(ss.readRegister(n))
+		}
+		return b.String(), false
+	case 'G':
+		for n := 0; n < registers && args != ""; n++ {
+			size := 2 * registerSize(n)
+			if len(args) < size {
+				return "E01", false
+			}
+			if !ss.writeRegister(n, args[:size]) {
+				return "E01", false
+			}
+			args = args[size:]
+		}
+		return "OK", false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= registers {
+			return "E01", false
+		}
+		return ss.readRegister(int(n)), false
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil || n >= registers || len(parts) != 2 || !ss.writeRegister(int(n), parts[1]) {
+			return "E01", false
+		}
+		return "OK", false
+	case 'm':
+		addr, n, ok := addressLength(args)
+		if !ok {
+			return "E01", false
+		}
+		if n > packetSize/2 {
+			n = packetSize / 2
+		}
+		b := make([]byte, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := ss.cpu.Memory.GetByte(addr + rune(i))
+			if err != nil {
+				break
+			}
+			b = append(b, v)
+		}
+		if len(b) == 0 && n > 0 {
+			return "E14", false
+		}
+		return hex.EncodeToString(b), false
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		addr, n, ok := addressLength(parts[0])
+		if !ok || len(parts) != 2 {
+			return "E01", false
+		}
+		b, err := hex.DecodeString(parts[1])
+		if err != nil || len(b) != n {
+			return "E01", false
+		}
+		for i, v := range b {
+			if err := ss.cpu.Memory.SetByte(addr+rune(i), v); err != nil {
+				return "E14", false
+			}
+		}
+		return "OK", false
+	case 'Z', 'z':
+		return ss.breakpoint(packet[0] == 'Z', args), false
+	case 's':
+		if !ss.jumpTo(args) {
+			return "E01", false
+		}
+		return ss.run(1), false
+	case 'c':
+		if !ss.jumpTo(args) {
+			return "E01", false
+		}
+		return ss.run(-1), false
+	case 'D':
+		return "OK", true
+	case 'k':
+		return "", true
+	case 'H':
+		return "OK", false
+	case 'T':
+		return "OK", false
+	case 'q', 'Q':
+		return ss.query(packet), false
+	}
+
+	// an empty reply tells GDB the command isn't supported
+	return "", false
+}
+
+func (ss *session) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;QStartNoAckMode+", packetSize)
+	case packet == "QStartNoAckMode":
+		ss.ack = false
+		return "OK"
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+		offset, n, ok := addressLength(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+		if !ok {
+			return "E01"
+		}
+		if int(offset) >= len(targetXML) {
+			return "l"
+		}
+		end := int(offset) + n
+		if end >= len(targetXML) {
+			return "l" + targetXML[offset:]
+		}
+		return "m" + targetXML[offset:end]
+	}
+
+	return ""
+}
+
+// jumpTo moves the PC to the optional address of the s and c packets.
+func (ss *session) jumpTo(args string) bool {
+	if args == "" {
+		return true
+	}
+
+	addr, err := strconv.ParseUint(args, 16, 16)
+	if err != nil {
+		return false
+	}
+
+	ss.cpu.R.PC = rune(addr)
+	return true
+}
+
+// run executes n instructions, or until a breakpoint when n is negative, and returns the stop reply.
+func (ss *session) run(n int) string {
+	for i := 0; n < 0 || i < n; i++ {
+		if ss.cpu.Exited {
+			return "W00"
+		}
+
+		res, err := ss.cpu.Step()
+		if err != nil {
+			if e, ok := err.(*cpu.Error); ok && e.Fault == cpu.MemoryFault {
+				return "S0b" // SIGSEGV
+			}
+			return "S04" // SIGILL
+		}
+
+		if len(res.Watch) > 0 {
+			h := res.Watch[0]
+			kind := "awatch"
+			if ss.watchKind(h.Addr) == mmu.Write {
+				kind = "watch"
+			} else if ss.watchKind(h.Addr) == mmu.Read {
+				kind = "rwatch"
+			}
+			return fmt.Sprintf("T05%s:%x;", kind, h.Addr)
+		}
+
+		if n < 0 && ss.breakpoints[ss.cpu.R.PC] {
+			return "S05"
+		}
+
+		if n < 0 && i%pollInterval == 0 {
+			select {
+			case b, ok := <-ss.in:
+				if !ok || b == interrupt {
+					return "S02" // SIGINT
+				}
+			default:
+			}
+		}
+	}
+
+	return "S05"
+}
+
+// breakpoint inserts or removes a breakpoint or a watchpoint, from the arguments "type,addr,kind" of the Z and z packets.
+func (ss *session) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+
+	addr, n, ok := addressLength(parts[1] + "," + parts[2])
+	if !ok {
+		return "E01"
+	}
+
+	var access mmu.Access
+	switch parts[0] {
+	case "0", "1":
+		if insert {
+			ss.breakpoints[addr] = true
+		} else {
+			delete(ss.breakpoints, addr)
+		}
+		return "OK"
+	case "2":
+		access = mmu.Write
+	case "3":
+		access = mmu.Read
+	case "4":
+		access = mmu.Read | mmu.Write
+	default:
+		return ""
+	}
+
+	key := args
+	if insert {
+		if _, ok := ss.watches[key]; !ok {
+			end := addr + rune(n) - 1
+			if n == 0 {
+				end = addr
+			}
+			ss.watches[key] = ss.cpu.Watch(cpu.Watchpoint{Start: addr, End: end, Access: access})
+		}
+		return "OK"
+	}
+
+	if id, ok := ss.watches[key]; ok {
+		ss.cpu.Unwatch(id)
+		delete(ss.watches, key)
+	}
+	return "OK"
+}
+
+// watchKind returns the accesses watched at addr.
+func (ss *session) watchKind(addr rune) mmu.Access {
+	var access mmu.Access
+	for key := range ss.watches {
+		parts := strings.Split(key, ",")
+		start, n, _ := addressLength(parts[1] + "," + parts[2])
+		if addr >= start && addr < start+rune(n) {
+			switch parts[0] {
+			case "2":
+				access |= mmu.Write
+			case "3":
+				access |= mmu.Read
+			case "4":
+				access |= mmu.Read | mmu.Write
+			}
+		}
+	}
+
+	return access
+}
+
+func registerSize(n int) int {
+	if n == 16 || n == 17 {
+		return 2
+	}
+
+	return 1
+}
+
+// readRegister returns the register n in hex, little-endian.
+func (ss *session) readRegister(n int) string {
+	r := ss.cpu.R
+	switch {
+	case n < 16:
+		return fmt.Sprintf("%02x", r.V[n])
+	case n == 16:
+		return fmt.Sprintf("%02x%02x", byte(r.I), byte(r.I>>8))
+	case n == 17:
+		return fmt.Sprintf("%02x%02x", byte(r.PC), byte(r.PC>>8))
+	case n == 18:
+		return fmt.Sprintf("%02x", r.SP)
+	case n == 19:
+		return fmt.Sprintf("%02x", r.DT)
+	}
+
+	return fmt.Sprintf("%02x", r.ST)
+}
+
+func (ss *session) writeRegister(n int, value string) bool {
+	b, err := hex.DecodeString(value)
+	if err != nil || len(b) != registerSize(n) {
+		return false
+	}
+
+	r := ss.cpu.R
+	switch {
+	case n < 16:
+		r.V[n] = b[0]
+	case n == 16:
+		r.I = rune(b[0]) | rune(b[1])<<8
+	case n == 17:
+		r.PC = rune(b[0]) | rune(b[1])<<8
+	case n == 18:
+		if int(b[0]) >= len(r.Stack) {
+			return false
+		}
+		r.SP = b[0]
+	case n == 19:
+		r.DT = b[0]
+	default:
+		r.ST = b[0]
+	}
+
+	return true
+}
+
+// addressLength parses "addr,length" in hex.
+func addressLength(s string) (rune, int, bool) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	addr, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	n, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return rune(addr), int(n), true
+}
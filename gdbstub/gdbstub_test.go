@@ -0,0 +1,128 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"net"
+	"strings"
+	"testing"
+)
+
+var rom = []byte{
+	0x60, 0x01, // 0x200 LD V0, 0x01
+	0x61, 0x02, // 0x202 LD V1, 0x02
+	0xA3, 0x00, // 0x204 LD I, 0x300
+	0xF1, 0x55, // 0x206 LD [I], V1
+	0x12, 0x08, // 0x208 JP 0x208
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	c := &cpu.CPU{}
+	c.Reset()
+	c.LoadData(rom)
+
+	server, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Server{CPU: c}).Serve(server)
+		server.Close()
+	}()
+
+	return &client{t, conn, bufio.NewReader(conn)}, done
+}
+
+// send sends a packet and returns the reply.
+func (cl *client) send(data string) string {
+	fmt.Fprintf(cl.conn, "$%s#%02x", data, checksum([]byte(data)))
+	if b, err := cl.r.ReadByte(); err != nil || b != '+' {
+		cl.t.Fatalf("%s: the packet should be acknowledged, actual: %q %v", data, b, err)
+	}
+
+	return cl.reply()
+}
+
+func (cl *client) reply() string {
+	s, err := cl.r.ReadString('#')
+	if err != nil {
+		cl.t.Fatal(err)
+	}
+	var sum [2]byte
+	cl.r.Read(sum[:1])
+	cl.r.Read(sum[1:])
+	cl.conn.Write([]byte("+"))
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "$"), "#")
+	if fmt.Sprintf("%02x", checksum([]byte(s))) != string(sum[:]) {
+		cl.t.Errorf("%s: bad checksum %s", s, sum)
+	}
+	return s
+}
+
+func TestSession(t *testing.T) {
+	cl, done := newClient(t)
+
+	tc := []struct {
+		packet, reply string
+	}{
+		{"qSupported:multiprocess+", "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"},
+		{"?", "S05"},
+		{"p11", "0002"},
+		{"s", "S05"},
+		{"g", "01000000000000000000000000000000" + "0000" + "0202" + "000000"},
+		{"P1=aa", "OK"},
+		{"p1", "aa"},
+		{"Z0,206,2", "OK"},
+		{"c", "S05"},
+		{"p11", "0602"},
+		{"Z2,301,1", "OK"},
+		{"c", "T05watch:301;"},
+		{"m300,2", "0102"},
+		{"M300,2:abcd", "OK"},
+		{"m300,2", "abcd"},
+		{"z2,301,1", "OK"},
+		{"P11=0002", "OK"},
+		{"c", "S05"},
+		{"m10000,1", "E14"},
+		{"mfffe,ffffffff", "0000"},
+		{"vMustReplyEmpty", ""},
+		{"qXfer:features:read:target.xml:0,10", "m<?xml version=\"1"},
+		{"p15", "E01"},
+	}
+
+	for _, c := range tc {
+		if reply := cl.send(c.packet); reply != c.reply {
+			t.Errorf("%s: the reply should be %q, actual: %q", c.packet, c.reply, reply)
+		}
+	}
+
+	if reply := cl.send("D"); reply != "OK" {
+		t.Errorf("detach should reply OK, actual: %q", reply)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	cl, done := newClient(t)
+	cl.send("QStartNoAckMode")
+
+	fmt.Fprintf(cl.conn, "$c#63")
+	cl.conn.Write([]byte{interrupt})
+	if reply := cl.reply(); reply != "S02" {
+		t.Errorf("the interrupt should stop the CPU, actual: %q", reply)
+	}
+
+	cl.conn.Close()
+	if err := <-done; err == nil {
+		t.Error("closing the connection should end the session with an error")
+	}
+}
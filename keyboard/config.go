@@ -0,0 +1,184 @@
+package keyboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultPreset is the preset used when neither the command line nor the keymap file selects one.
+const DefaultPreset = "hex"
+
+// A Binding maps the name of a physical input to the hex key it presses, e.g. "Q": "4". Several inputs may press the same key.
+//
+// Keyboard keys are named after the SDL key names, so the bindings follow the keyboard layout selected in the operating system.
+// Game controller buttons are named "pad:" followed by the SDL button name (a, b, x, y, back, start, leftshoulder,
+// rightshoulder, dpup, dpdown, dpleft, dpright...). Joysticks unknown to SDL as game controllers use "joy:button0",
+// "joy:button1"... for their buttons and "joy:up", "joy:down", "joy:left" and "joy:right" for their first hat.
+type Binding map[string]string
+
+// Presets are the built-in bindings. Except for "hex", they put the keypad on the 4x4 block of keys below the digits, as on
+// the COSMAC VIP:
+//
+//	1 2 3 C
+//	4 5 6 D
+//	7 8 9 E
+//	A 0 B F
+//
+// Every preset also binds the directions of the game controllers to 2, 4, 6 and 8, the most common movement keys, and their
+// main buttons to 5 and 0.
+var Presets = map[string]Binding{
+	"hex": withPad(Binding{
+		"0": "0", "1": "1", "2": "2", "3": "3", "4": "4", "5": "5", "6": "6", "7": "7",
+		"8": "8", "9": "9", "A": "A", "B": "B", "C": "C", "D": "D", "E": "E", "F": "F",
+	}),
+	"qwerty": withPad(Binding{
+		"1": "1", "2": "2", "3": "3", "4": "C",
+		"Q": "4", "W": "5", "E": "6", "R": "D",
+		"A": "7", "S": "8", "D": "9", "F": "E",
+		"Z": "A", "X": "0", "C": "B", "V": "F",
+	}),
+	"azerty": withPad(Binding{
+		"1": "1", "2": "2", "3": "3", "4": "C",
+		"A": "4", "Z": "5", "E": "6", "R": "D",
+		"Q": "7", "S": "8", "D": "9", "F": "E",
+		"W": "A", "X": "0", "C": "B", "V": "F",
+	}),
+	"dvorak": withPad(Binding{
+		"1": "1", "2": "2", "3": "3", "4": "C",
+		"'": "4", ",": "5", ".": "6", "P": "D",
+		"A": "7", "O": "8", "E": "9", "U": "E",
+		";": "A", "Q": "0", "J": "B", "K": "F",
+	}),
+}
+
+// padBinding is added to every preset.
+var padBinding = Binding{
+	"pad:dpup": "2", "pad:dpleft": "4", "pad:dpright": "6", "pad:dpdown": "8", "pad:a": "5", "pad:b": "0",
+	"joy:up": "2", "joy:left": "4", "joy:right": "6", "joy:down": "8", "joy:button0": "5", "joy:button1": "0",
+}
+
+func withPad(b Binding) Binding {
+	for input, key := range padBinding {
+		b[input] = key
+	}
+
+	return b
+}
+
+// PadButtons are the game controller buttons, by binding name, numbered as SDL_GameControllerButton.
+var PadButtons = map[string]int{
+	"a": 0, "b": 1, "x": 2, "y": 3, "back": 4, "guide": 5, "start": 6, "leftstick": 7, "rightstick": 8,
+	"leftshoulder": 9, "rightshoulder": 10, "dpup": 11, "dpdown": 12, "dpleft": 13, "dpright": 14,
+}
+
+// JoyDirections are the directions of the first joystick hat, by binding name, as the SDL_HAT_* bits.
+var JoyDirections = map[string]uint8{"up": 0x01, "right": 0x02, "down": 0x04, "left": 0x08}
+
+// checkInput rejects the unknown game controller and joystick inputs. The keyboard key names are only known to SDL.
+func checkInput(input string) error {
+	switch {
+	case strings.HasPrefix(input, "pad:"):
+		if _, ok := PadButtons[strings.TrimPrefix(input, "pad:")]; !ok {
+			return fmt.Errorf("unknown game controller button %q", input)
+		}
+	case strings.HasPrefix(input, "joy:button"):
+		n, err := strconv.Atoi(strings.TrimPrefix(input, "joy:button"))
+		if err != nil || n < 0 {
+			return fmt.Errorf("unknown joystick button %q", input)
+		}
+	case strings.HasPrefix(input, "joy:"):
+		if _, ok := JoyDirections[strings.TrimPrefix(input, "joy:")]; !ok {
+			return fmt.Errorf("unknown joystick direction %q", input)
+		}
+	}
+
+	return nil
+}
+
+// Keys returns the hex key bound to each input.
+func (b Binding) Keys() (map[string]byte, error) {
+	keys := make(map[string]byte, len(b))
+	for input, key := range b {
+		if err := checkInput(input); err != nil {
+			return nil, err
+		}
+
+		k, err := strconv.ParseUint(key, 16, 8)
+		if err != nil || k > 0x0F {
+			return nil, fmt.Errorf("%q is bound to %q which is not a hex key", input, key)
+		}
+		keys[input] = byte(k)
+	}
+
+	return keys, nil
+}
+
+// Config is the content of a keymap file, for instance:
+//
+//	{
+//		"default": "mine",
+//		"presets": {"mine": {"1": "1", "2": "2", "3": "3", "4": "C", "Q": "4", ...}},
+//		"roms": {"PONG.ch8": "hex"}
+//	}
+//
+// The presets of the file add to, or replace, the built-in ones. The roms section selects the preset of a ROM from its file name.
+type Config struct {
+	Default string             `json:"default"`
+	Presets map[string]Binding `json:"presets"`
+	ROMs    map[string]string  `json:"roms"`
+}
+
+// LoadConfig reads a keymap file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Config)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	for name, binding := range c.Presets {
+		if _, err := binding.Keys(); err != nil {
+			return nil, fmt.Errorf("%s: preset %q: %s", path, name, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Binding returns the binding to use for the ROM. The preset is, by order of precedence, the given name, the override of the
+// ROM, the default of the file and DefaultPreset. A nil Config only knows the built-in presets.
+func (c *Config) Binding(name, rom string) (Binding, error) {
+	if c == nil {
+		c = new(Config)
+	}
+
+	if name == "" {
+		name = c.ROMs[filepath.Base(rom)]
+	}
+
+	if name == "" {
+		name = c.Default
+	}
+
+	if name == "" {
+		name = DefaultPreset
+	}
+
+	if b, ok := c.Presets[name]; ok {
+		return b, nil
+	}
+
+	if b, ok := Presets[name]; ok {
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unknown keymap preset %q", name)
+}
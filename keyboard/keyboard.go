@@ -1,32 +1,18 @@
 package keyboard
 
-import "github.com/veandco/go-sdl2/sdl"
-
-// This map binds the value returned by the keyboard to the corresponding chip-8 value.
-var KeyMap map[byte]sdl.Scancode = map[byte]sdl.Scancode{
-	0x00: sdl.SCANCODE_0, // "0"
-	0x01: sdl.SCANCODE_1, // "1"
-	0x02: sdl.SCANCODE_2, // "2"
-	0x03: sdl.SCANCODE_3, // "3"
-	0x04: sdl.SCANCODE_4, // "4"
-	0x05: sdl.SCANCODE_5, // "5"
-	0x06: sdl.SCANCODE_6, // "6"
-	0x07: sdl.SCANCODE_7, // "7"
-	0x08: sdl.SCANCODE_8, // "8"
-	0x09: sdl.SCANCODE_9, // "9"
-	0x0A: sdl.SCANCODE_A, // "a"
-	0x0B: sdl.SCANCODE_B, // "b"
-	0x0C: sdl.SCANCODE_C, // "c"
-	0x0D: sdl.SCANCODE_D, // "d"
-	0x0E: sdl.SCANCODE_E, // "e"
-	0x0F: sdl.SCANCODE_F, // "f"
-}
-
+// Keyboard holds the state of the 16 keys of the hex keypad, KeyState being updated from the Source on each Update.
 type Keyboard struct {
 	KeyState map[byte]bool
+	Source   Source // defaults to a NullSource when nil
+
+	previous map[byte]bool // KeyState before the last Update
 }
 
 func (kb *Keyboard) Reset() {
+	if kb.Source == nil {
+		kb.Source = NullSource{}
+	}
+
 	kb.KeyState = map[byte]bool{
 		0x00: false,
 		0x01: false,
@@ -45,6 +31,7 @@ func (kb *Keyboard) Reset() {
 		0x0E: false,
 		0x0F: false,
 	}
+	kb.previous = nil
 }
 
 func (kb *Keyboard) KeyStateToFalse() {
@@ -53,13 +40,67 @@ func (kb *Keyboard) KeyStateToFalse() {
 	}
 }
 
-func IsKeyPressed(b byte) bool {
-	keyboardState := sdl.GetKeyboardState()
-	code := KeyMap[b]
-	pressed := keyboardState[code]
-	if pressed == 1 {
-		return true
-	} else {
-		return false
+// Update polls the source for the state of every key, keeping the previous one to detect the presses and the releases.
+func (kb *Keyboard) Update() {
+	if kb.previous == nil {
+		kb.previous = make(map[byte]bool, len(kb.KeyState))
+	}
+
+	for k, pressed := range kb.KeyState {
+		kb.previous[k] = pressed
+	}
+
+	kb.KeyStateToFalse()
+	kb.Source.Poll(kb.KeyState)
+}
+
+// JustPressed returns the lowest key which went down during the last Update.
+func (kb *Keyboard) JustPressed() (byte, bool) {
+	for k := byte(0x00); k <= 0x0F; k++ {
+		if kb.KeyState[k] && !kb.previous[k] {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
+
+// Consume forgets that the key went down during the last Update, so that JustPressed reports each press once.
+func (kb *Keyboard) Consume(k byte) {
+	if kb.previous == nil {
+		kb.previous = make(map[byte]bool, len(kb.KeyState))
+	}
+
+	kb.previous[k] = kb.KeyState[k]
+}
+
+// JustReleased reports whether the key went up during the last Update.
+func (kb *Keyboard) JustReleased(k byte) bool {
+	return !kb.KeyState[k] && kb.previous[k]
+}
+
+// State returns the current and the previous state of the keys, bit k being set when key k is down.
+func (kb *Keyboard) State() (current, previous uint16) {
+	for k := byte(0x00); k <= 0x0F; k++ {
+		if kb.KeyState[k] {
+			current |= 1 << k
+		}
+		if kb.previous[k] {
+			previous |= 1 << k
+		}
+	}
+
+	return current, previous
+}
+
+// SetState restores the states returned by State.
+func (kb *Keyboard) SetState(current, previous uint16) {
+	if kb.previous == nil {
+		kb.previous = make(map[byte]bool, 16)
+	}
+
+	for k := byte(0x00); k <= 0x0F; k++ {
+		kb.KeyState[k] = current&(1<<k) != 0
+		kb.previous[k] = previous&(1<<k) != 0
 	}
 }
@@ -1 +1,217 @@
 package keyboard
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestJustPressedAndReleased(t *testing.T) {
+	kb := new(Keyboard)
+	kb.Reset()
+
+	if _, ok := kb.JustPressed(); ok {
+		t.Error("no key should be pressed after a reset")
+	}
+
+	kb.previous = map[byte]bool{0x03: true}
+	kb.KeyState[0x05] = true
+	kb.KeyState[0x0A] = true
+
+	if k, ok := kb.JustPressed(); !ok || k != 0x05 {
+		t.Errorf("key 5 should be just pressed, got %x %t", k, ok)
+	}
+
+	if !kb.JustReleased(0x03) {
+		t.Error("key 3 should be just released")
+	}
+
+	if kb.JustReleased(0x05) {
+		t.Error("key 5 should not be just released")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	kb := &Keyboard{Source: &ScriptedSource{Frames: []uint16{0x0021, 0x0001}}}
+	kb.Reset()
+
+	kb.Update()
+	if !kb.KeyState[0x00] || !kb.KeyState[0x05] || kb.KeyState[0x01] {
+		t.Errorf("keys 0 and 5 should be pressed, got %v", kb.KeyState)
+	}
+
+	kb.Update()
+	if !kb.KeyState[0x00] || kb.KeyState[0x05] || !kb.JustReleased(0x05) {
+		t.Errorf("key 5 should be released, got %v", kb.KeyState)
+	}
+
+	kb.Update()
+	if kb.KeyState[0x00] {
+		t.Error("every key should be released at the end of the script")
+	}
+}
+
+func TestNullSource(t *testing.T) {
+	kb := new(Keyboard)
+	kb.Reset()
+	kb.Update()
+
+	for k, pressed := range kb.KeyState {
+		if pressed {
+			t.Errorf("key %x should not be pressed", k)
+		}
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for name, b := range Presets {
+		keys, err := b.Keys()
+		if err != nil {
+			t.Errorf("preset %s: %s", name, err)
+		}
+
+		bound := make(map[byte]bool)
+		for _, k := range keys {
+			bound[k] = true
+		}
+
+		if len(bound) != 16 {
+			t.Errorf("preset %s binds %d keys, expected 16", name, len(bound))
+		}
+	}
+}
+
+func TestBindingKeys(t *testing.T) {
+	tc := []struct {
+		input, key string
+		ok         bool
+	}{
+		{"Q", "4", true},
+		{"pad:a", "5", true},
+		{"pad:dpleft", "4", true},
+		{"pad:rightshoulder", "F", true},
+		{"joy:button0", "5", true},
+		{"joy:button12", "C", true},
+		{"joy:up", "2", true},
+		{"joy:right", "6", true},
+		{"Q", "10", false},
+		{"pad:a", "G", false},
+		{"pad:z", "5", false},
+		{"pad:", "5", false},
+		{"joy:button", "5", false},
+		{"joy:button-1", "5", false},
+		{"joy:buttonA", "5", false},
+		{"joy:upleft", "2", false},
+	}
+
+	for _, c := range tc {
+		keys, err := Binding{c.input: c.key}.Keys()
+		if c.ok && err != nil {
+			t.Errorf("%s: %s should be accepted, got %s", c.input, c.key, err)
+		}
+
+		if !c.ok && err == nil {
+			t.Errorf("%s: %s should be rejected, got %v", c.input, c.key, keys)
+		}
+	}
+}
+
+func TestPresetsPad(t *testing.T) {
+	expected := map[string]byte{
+		"pad:dpup": 0x2, "pad:dpleft": 0x4, "pad:dpright": 0x6, "pad:dpdown": 0x8, "pad:a": 0x5, "pad:b": 0x0,
+		"joy:up": 0x2, "joy:left": 0x4, "joy:right": 0x6, "joy:down": 0x8, "joy:button0": 0x5, "joy:button1": 0x0,
+	}
+
+	for name, b := range Presets {
+		keys, err := b.Keys()
+		if err != nil {
+			t.Fatalf("preset %s: %s", name, err)
+		}
+
+		for input, k := range expected {
+			if actual, ok := keys[input]; !ok || actual != k {
+				t.Errorf("preset %s should bind %s to %X, got %X %t", name, input, k, actual, ok)
+			}
+		}
+	}
+}
+
+func TestConfigBinding(t *testing.T) {
+	f, err := ioutil.TempFile("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{
+		"default": "azerty",
+		"presets": {"arrows": {"Up": "2", "Down": "8", "Left": "4", "Right": "6", "Space": "5"}},
+		"roms": {"PONG.ch8": "arrows"}
+	}`)
+	f.Close()
+
+	c, err := LoadConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name, rom string
+		expected  Binding
+	}{
+		{"", "roms/PONG.ch8", c.Presets["arrows"]},
+		{"", "roms/TETRIS.ch8", Presets["azerty"]},
+		{"dvorak", "roms/PONG.ch8", Presets["dvorak"]},
+	}
+
+	for _, tt := range tc {
+		b, err := c.Binding(tt.name, tt.rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(b, tt.expected) {
+			t.Errorf("binding for %q %q should be %v, got %v", tt.name, tt.rom, tt.expected, b)
+		}
+	}
+
+	if _, err := c.Binding("colemak", ""); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+
+	var none *Config
+	if b, err := none.Binding("", "PONG.ch8"); err != nil || !reflect.DeepEqual(b, Presets[DefaultPreset]) {
+		t.Errorf("a nil config should return the default preset, got %v %v", b, err)
+	}
+}
+
+func TestLoadConfigInvalidKey(t *testing.T) {
+	f, err := ioutil.TempFile("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"presets": {"bad": {"Q": "10"}}}`)
+	f.Close()
+
+	if _, err := LoadConfig(f.Name()); err == nil {
+		t.Error("expected an error for a key outside of the keypad")
+	}
+}
+
+func TestLoadConfigInvalidInput(t *testing.T) {
+	f, err := ioutil.TempFile("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(`{"presets": {"bad": {"pad:select": "5"}}}`)
+	f.Close()
+
+	if _, err := LoadConfig(f.Name()); err == nil {
+		t.Error("expected an error for an unknown game controller button")
+	}
+}
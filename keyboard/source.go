@@ -0,0 +1,34 @@
+package keyboard
+
+// A Source reports the state of the physical inputs bound to the hex keypad.
+//
+// Poll is called once per frame with every key released, and sets to true the keys currently held down.
+type Source interface {
+	Poll(state map[byte]bool)
+}
+
+// NullSource never presses any key.
+type NullSource struct{}
+
+func (NullSource) Poll(state map[byte]bool) {}
+
+// ScriptedSource replays a sequence of keypad states, one per Poll. Bit k of a frame is set when key k is down. Once the
+// script is over, every key stays released.
+type ScriptedSource struct {
+	Frames []uint16
+	Frame  int // index of the next frame to replay
+}
+
+func (s *ScriptedSource) Poll(state map[byte]bool) {
+	if s.Frame >= len(s.Frames) {
+		return
+	}
+
+	keys := s.Frames[s.Frame]
+	for k := byte(0x00); k <= 0x0F; k++ {
+		if keys&(1<<k) != 0 {
+			state[k] = true
+		}
+	}
+	s.Frame++
+}
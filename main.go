@@ -2,29 +2,227 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/jordanabderrachid/go-chip8/cpu"
-	"log"
+	"github.com/jordanabderrachid/go-chip8/movie"
+	"github.com/jordanabderrachid/go-chip8/octo"
+	"github.com/jordanabderrachid/go-chip8/rewind"
+	"github.com/jordanabderrachid/go-chip8/trace"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	runtime.LockOSThread()
-	logfile, err := os.Create("log")
+
+	romFile := flag.String("r", "", "rom file, Octo sources ending with .8o are compiled first")
+	headless := flag.Bool("headless", false, "run without a window, then print the registers and the framebuffer hash")
+	cycles := flag.Int("cycles", 0, "number of instructions to execute in headless mode")
+	frames := flag.Int("frames", 0, "number of frames to execute in headless mode")
+	speed := flag.Int("speed", cpu.DefaultCyclesPerFrame, "instructions executed per frame, at 60 frames per second")
+	quirks := flag.String("quirks", "", "quirks profile: vip, chip48, schip or xochip")
+	keymap := flag.String("keymap", "", "keymap preset: hex, qwerty, azerty, dvorak or one of the keymap file")
+	keymapFile := flag.String("keymap-file", "", "JSON keymap file with custom presets and per-ROM overrides")
+	loadStateFile := flag.String("load-state", "", "save state to load after the ROM, F5 and F9 save and load <rom>.state")
+	recordFile := flag.String("record", "", "record the inputs into a movie file, saved on exit")
+	replayFile := flag.String("replay", "", "replay a movie file without a window and check the state it ends in")
+	rewindFrames := flag.Int("rewind", 600, "number of snapshots kept to rewind with backspace, 0 disables the rewind")
+	rewindInterval := flag.Int("rewind-interval", 1, "frames between two snapshots of the rewind history")
+	seed := flag.Int64("seed", 0, seedUsage)
+	traceFile := flag.String("trace", "", "write the trace of the executed instructions to a file")
+	traceFormat := flag.String("trace-format", "json", "format of the trace: json lines or binary")
+	flag.Parse()
+
+	*seed = pickSeed(*seed)
+
+	if (*recordFile != "" || *replayFile != "") && *loadStateFile != "" {
+		fmt.Fprintln(os.Stderr, "movies start from the reset of the machine, -load-state can't be used with -record or -replay")
+		os.Exit(2)
+	}
+
+	b, err := readROM(*romFile)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	log.SetOutput(logfile)
 
-	romFile := flag.String("r", "", "rom file")
-	flag.Parse()
+	CPU := &cpu.CPU{CyclesPerFrame: *speed, Seed: *seed}
+	if *quirks != "" {
+		q, ok := cpu.QuirksProfiles[*quirks]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown quirks profile %q\n", *quirks)
+			os.Exit(2)
+		}
+		CPU.Quirks = q
+	}
+
+	var tracer trace.Writer
+	if *traceFile != "" {
+		// the file is only created once the format is known to be valid
+		out := new(struct{ io.Writer })
+		tracer, err = trace.NewWriter(out, *traceFormat)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		out.Writer = f
+		CPU.Tracer = tracer
+	}
+
+	if *replayFile != "" {
+		err := replay(CPU, *replayFile, b)
+		if err == nil && tracer != nil {
+			err = tracer.Flush()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if !*headless {
+		CPU.Renderer = new(sdlRenderer)
+		CPU.AudioSink = new(sdlSink)
+		CPU.Input, err = keyboardSource(*keymap, *keymapFile, *romFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	var m *movie.Movie
+	if *recordFile != "" {
+		m = movie.New(CPU, b)
+		CPU.Input = m.Record(CPU.Input)
+	}
+	if err := CPU.Reset(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := CPU.LoadData(b); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *loadStateFile != "" {
+		if err := loadState(CPU, *loadStateFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *headless {
+		_, err = CPU.StepN(*cycles)
+		if err == nil {
+			err = CPU.RunFrames(*frames)
+		}
+
+		printState(CPU)
+	} else {
+		fmt.Fprintf(os.Stderr, "seed: %d\n", CPU.Seed)
+		var history *rewind.Buffer
+		if *rewindFrames > 0 && m == nil {
+			history = rewind.New(*rewindFrames, *rewindInterval)
+		}
+		err = runWindowed(CPU, *romFile+".state", m != nil, history)
+	}
+
+	if tracer != nil {
+		if err := tracer.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if m != nil {
+		if err := saveMovie(m, CPU, *recordFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// clockSeed given to -seed picks the seed from the clock, any other value is used as is.
+const clockSeed = -1
+
+const seedUsage = "seed of the random number generator, -1 picks one from the clock"
+
+func pickSeed(seed int64) int64 {
+	if seed == clockSeed {
+		return time.Now().UnixNano()
+	}
+
+	return seed
+}
+
+// readROM reads a ROM, or compiles it when it is an Octo source.
+func readROM(path string) ([]byte, error) {
+	if filepath.Ext(path) == ".8o" {
+		p, err := octo.CompileFile(path)
+		if err != nil {
+			return nil, err
+		}
 
-	CPU := new(cpu.CPU)
-	CPU.Reset()
+		return p.Bytes, nil
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+func printState(c *cpu.CPU) {
+	fmt.Println(c.R)
+	fmt.Printf("seed %d\n", c.Seed)
+	fmt.Printf("framebuffer %s\n", c.Display.Hash())
+}
+
+// replay runs the movie and prints the state it ends in.
+func replay(c *cpu.CPU, path string, rom []byte) error {
+	m, err := movie.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Replay(c, rom); err != nil {
+		return err
+	}
+
+	printState(c)
+	fmt.Printf("replay ok, %d frames, state %s\n", len(m.Frames), m.Hash)
+	return nil
+}
+
+func saveMovie(m *movie.Movie, c *cpu.CPU, path string) error {
+	if err := m.Finish(c); err != nil {
+		return err
+	}
 
-	f, _ := os.Open(*romFile)
-	b := make([]byte, 3584)
-	f.Read(b)
-	CPU.LoadData(b)
-	CPU.Run()
+	return m.Save(path)
 }
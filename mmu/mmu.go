@@ -3,32 +3,37 @@ package mmu
 import (
 	"fmt"
 	"github.com/jordanabderrachid/go-chip8/display"
-	"log"
 )
 
-const memorySize rune = 0x1000 // 4096
+// The XO-CHIP address space, the original 4096 bytes being the lowest part of it.
+const memorySize rune = 0x10000 // 65536
+
+// Size is the number of addressable bytes.
+const Size int = int(memorySize)
 
 type Memory struct {
-	m [memorySize]byte // 4096 bytes
+	m [memorySize]byte // 65536 bytes
+
+	watchpoints []watchpoint
+	lastWatch   int
 }
 
 func (mem *Memory) Reset() {
-	log.Println("reseting memory")
 	for i := range mem.m {
 		mem.SetByte(rune(i), 0x00)
 	}
 }
 
 func (mem *Memory) LoadSprites() error {
-	log.Println("loading sprites")
-	var addr rune = 0x0000
-	for i := 0; i <= 0x0F; i++ {
-		s := display.Sprites[byte(i)]
-		for _, b := range s {
-			if err := mem.SetByte(addr, b); err != nil {
-				return err
-			}
-			addr++
+	for i := byte(0); i <= 0x0F; i++ {
+		s := display.Sprites[i]
+		if err := mem.AllocateWithBuffer(s[:], display.SpritesAddresses[i]); err != nil {
+			return err
+		}
+
+		bs := display.BigSprites[i]
+		if err := mem.AllocateWithBuffer(bs[:], display.BigSpritesAddresses[i]); err != nil {
+			return err
 		}
 	}
 
@@ -56,18 +61,43 @@ func (mem *Memory) AllocateWithBuffer(buffer []byte, offset rune) error {
 }
 
 func (mem *Memory) GetByte(addr rune) (byte, error) {
-	if addr > memorySize || addr < 0 {
-		return 0, fmt.Errorf("Illegal address %04x\n", addr)
+	if addr >= memorySize || addr < 0 {
+		return 0, fmt.Errorf("Illegal address %04x", addr)
+	}
+
+	if len(mem.watchpoints) > 0 {
+		mem.hit(addr, Read, mem.m[addr])
 	}
 
 	return mem.m[addr], nil
 }
 
 func (mem *Memory) SetByte(addr rune, b byte) error {
-	if addr > memorySize || addr < 0 {
-		return fmt.Errorf("Illegal address %04x\n", addr)
+	if addr >= memorySize || addr < 0 {
+		return fmt.Errorf("Illegal address %04x", addr)
 	}
 
 	mem.m[addr] = b
+	if len(mem.watchpoints) > 0 {
+		mem.hit(addr, Write, b)
+	}
+
+	return nil
+}
+
+// Dump returns a copy of the whole memory.
+func (mem *Memory) Dump() []byte {
+	b := make([]byte, memorySize)
+	copy(b, mem.m[:])
+	return b
+}
+
+// Restore replaces the whole memory with a dump.
+func (mem *Memory) Restore(b []byte) error {
+	if len(b) != int(memorySize) {
+		return fmt.Errorf("memory dump should be %d bytes, got %d", memorySize, len(b))
+	}
+
+	copy(mem.m[:], b)
 	return nil
 }
@@ -2,6 +2,7 @@ package mmu
 
 import (
 	"bytes"
+	"github.com/jordanabderrachid/go-chip8/display"
 	"testing"
 )
 
@@ -28,6 +29,14 @@ func TestLoadSprites(t *testing.T) {
 	if err := mem.LoadSprites(); err != nil {
 		t.Errorf("Failed loading sprites %s", err)
 	}
+
+	if b, _ := mem.GetByte(display.SpritesAddresses[0x0F] + 4); b != display.Sprites[0x0F][4] {
+		t.Errorf("Expected %02x at the end of the font, got %02x", display.Sprites[0x0F][4], b)
+	}
+
+	if b, _ := mem.GetByte(display.BigSpritesAddresses[0x0F] + 9); b != display.BigSprites[0x0F][9] {
+		t.Errorf("Expected %02x at the end of the big font, got %02x", display.BigSprites[0x0F][9], b)
+	}
 }
 
 func TestAllocate(t *testing.T) {
@@ -66,6 +75,10 @@ func TestGetByte(t *testing.T) {
 		t.Errorf("Expected %02x Got %02x", 3, b)
 	}
 
+	if _, err := mem.GetByte(memorySize); err == nil {
+		t.Errorf("Expected error with call address %x", memorySize)
+	}
+
 	if _, err := mem.GetByte(memorySize + 1); err == nil {
 		t.Errorf("Expected error with call address %x", memorySize+1)
 	}
@@ -97,3 +110,37 @@ func TestSetByte(t *testing.T) {
 		t.Errorf("Error setting byte, expected %x, got %x, at %04x", b, res, addr)
 	}
 }
+
+func TestWatch(t *testing.T) {
+	mem := new(Memory)
+	var hits []Hit
+	id := mem.Watch(0x300, 0x302, Write, func(h Hit) { hits = append(hits, h) })
+	mem.Watch(0x302, 0x302, Read, func(h Hit) { hits = append(hits, h) })
+
+	mem.SetByte(0x2FF, 0x01)
+	mem.SetByte(0x300, 0x02)
+	mem.GetByte(0x300)
+	mem.SetByte(0x302, 0x03)
+	mem.GetByte(0x302)
+	mem.SetByte(0x303, 0x04)
+
+	expected := []Hit{{0x300, Write, 0x02}, {0x302, Write, 0x03}, {0x302, Read, 0x03}}
+	if len(hits) != len(expected) {
+		t.Fatalf("hits should be %v, actual: %v\n", expected, hits)
+	}
+	for i := range expected {
+		if hits[i] != expected[i] {
+			t.Errorf("hit %d should be %v, actual: %v\n", i, expected[i], hits[i])
+		}
+	}
+
+	if !mem.Unwatch(id) || mem.Unwatch(id) {
+		t.Errorf("watchpoint should be removed once")
+	}
+
+	hits = nil
+	mem.SetByte(0x300, 0x05)
+	if len(hits) != 0 {
+		t.Errorf("removed watchpoint should not be hit, actual: %v\n", hits)
+	}
+}
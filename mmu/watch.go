@@ -0,0 +1,64 @@
+package mmu
+
+// Access is a kind of memory access.
+type Access int
+
+const (
+	Read Access = 1 << iota
+	Write
+)
+
+func (a Access) String() string {
+	switch a {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Read | Write:
+		return "read/write"
+	}
+
+	return "none"
+}
+
+// A Hit reports an access to a watched range of memory.
+type Hit struct {
+	Addr   rune
+	Access Access
+	Value  byte // byte read, or written
+}
+
+type watchpoint struct {
+	id         int
+	start, end rune
+	access     Access
+	fn         func(Hit)
+}
+
+// Watch calls fn on each access of the given kinds to the addresses from start to end included, through GetByte and SetByte.
+// It returns an id for Unwatch.
+func (mem *Memory) Watch(start, end rune, access Access, fn func(Hit)) int {
+	mem.lastWatch++
+	mem.watchpoints = append(mem.watchpoints, watchpoint{mem.lastWatch, start, end, access, fn})
+	return mem.lastWatch
+}
+
+// Unwatch removes a watchpoint, and reports whether it existed.
+func (mem *Memory) Unwatch(id int) bool {
+	for i, w := range mem.watchpoints {
+		if w.id == id {
+			mem.watchpoints = append(mem.watchpoints[:i], mem.watchpoints[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (mem *Memory) hit(addr rune, access Access, value byte) {
+	for _, w := range mem.watchpoints {
+		if w.access&access != 0 && addr >= w.start && addr <= w.end {
+			w.fn(Hit{addr, access, value})
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Package monitor is an interactive debugger driving a CPU one instruction at a time.
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"github.com/jordanabderrachid/go-chip8/mmu"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const help = `commands:
+  break addr          set a breakpoint (b)
+  delete addr         remove a breakpoint (d)
+  breakpoints         list the breakpoints
+  watch start [end] [r|w|rw]
+                      pause when an instruction writes, or reads, the addresses (w)
+  unwatch id          remove a watchpoint
+  step [n]            execute n instructions, 1 by default (s)
+  next                execute an instruction, running subroutine calls to their return (n)
+  finish              run until the current subroutine returns
+  continue            run until a breakpoint, the end of the program, a fault, or a program stuck at an address (c)
+  regs                print the registers (r)
+  set reg value       set V0 to VF, I, PC, SP, DT or ST
+  mem addr [n]        dump n bytes of memory, 64 by default (x)
+  poke addr byte...   write bytes to memory
+  stack               print the return addresses of the stack
+  list [addr] [n]     disassemble n instructions around the address, the PC by default (l)
+  press key           hold a key of the hex keypad down
+  release key         release a key of the hex keypad
+  help                print this help (h)
+  quit                leave the debugger (q)
+Addresses and values are decimal, or hex when prefixed with 0x.
+`
+
+// Monitor reads commands from In and writes their results to Out.
+type Monitor struct {
+	CPU *cpu.CPU
+	In  io.Reader
+	Out io.Writer
+
+	breakpoints map[rune]bool
+	keys        *Keys
+}
+
+// Keys is the keyboard source of the CPU under the monitor, holding the keys pressed by the press command.
+type Keys struct {
+	Held uint16
+}
+
+func (k *Keys) Poll(state map[byte]bool) {
+	for key := byte(0x00); key <= 0x0F; key++ {
+		if k.Held&(1<<key) != 0 {
+			state[key] = true
+		}
+	}
+}
+
+// New returns a monitor for the CPU, which is reset with the keyboard source of the monitor. The program must be loaded
+// afterwards.
+func New(c *cpu.CPU, in io.Reader, out io.Writer) (*Monitor, error) {
+	m := &Monitor{CPU: c, In: in, Out: out, breakpoints: make(map[rune]bool), keys: new(Keys)}
+	c.Input = m.keys
+	if err := c.Reset(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Run reads and executes commands until quit or the end of the input.
+func (m *Monitor) Run() error {
+	s := bufio.NewScanner(m.In)
+	m.list(m.CPU.R.PC, 1)
+	for {
+		fmt.Fprint(m.Out, "(chip8) ")
+		if !s.Scan() {
+			fmt.Fprintln(m.Out)
+			return s.Err()
+		}
+
+		quit, err := m.Exec(s.Text())
+		if err != nil {
+			fmt.Fprintf(m.Out, "error: %s\n", err)
+		}
+
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Exec executes a command line, and reports whether it was quit.
+func (m *Monitor) Exec(line string) (bool, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "quit", "q":
+		return true, nil
+	case "help", "h":
+		fmt.Fprint(m.Out, help)
+	case "break", "b":
+		addr, err := m.argument(args, 0, -1)
+		if err != nil {
+			return false, err
+		}
+		m.breakpoints[addr] = true
+		fmt.Fprintf(m.Out, "breakpoint at 0x%03X\n", addr)
+	case "delete", "d":
+		addr, err := m.argument(args, 0, -1)
+		if err != nil {
+			return false, err
+		}
+		if !m.breakpoints[addr] {
+			return false, fmt.Errorf("no breakpoint at 0x%03X", addr)
+		}
+		delete(m.breakpoints, addr)
+	case "breakpoints":
+		for _, addr := range m.sortedBreakpoints() {
+			fmt.Fprintf(m.Out, "0x%03X\n", addr)
+		}
+	case "watch", "w":
+		return false, m.watch(args)
+	case "unwatch":
+		id, err := m.argument(args, 0, -1)
+		if err != nil {
+			return false, err
+		}
+		if !m.CPU.Unwatch(int(id)) {
+			return false, fmt.Errorf("no watchpoint %d", id)
+		}
+	case "step", "s":
+		n, err := m.argument(args, 0, 1)
+		if err != nil {
+			return false, err
+		}
+		return false, m.run(int(n), nil)
+	case "next", "n":
+		in := m.decode(m.CPU.R.PC)
+		if in.Flow != disasm.Call {
+			return false, m.run(1, nil)
+		}
+		sp, ret := m.CPU.R.SP, m.CPU.R.PC+2
+		return false, m.run(-1, func() bool { return m.CPU.R.PC == ret && m.CPU.R.SP == sp })
+	case "finish":
+		if m.CPU.R.SP == 0 {
+			return false, fmt.Errorf("not in a subroutine")
+		}
+		sp := m.CPU.R.SP
+		return false, m.run(-1, func() bool { return m.CPU.R.SP < sp })
+	case "continue", "c":
+		return false, m.run(-1, nil)
+	case "regs", "r":
+		fmt.Fprintln(m.Out, m.CPU.R)
+		fmt.Fprintf(m.Out, "cycles %d\n", m.CPU.Cycles)
+	case "set":
+		return false, m.set(args)
+	case "mem", "x":
+		addr, err := m.argument(args, 0, -1)
+		if err != nil {
+			return false, err
+		}
+		n, err := m.argument(args, 1, 64)
+		if err != nil {
+			return false, err
+		}
+		return false, m.dump(addr, int(n))
+	case "poke":
+		if len(args) < 2 {
+			return false, fmt.Errorf("usage: poke addr byte...")
+		}
+		addr, err := parse(args[0])
+		if err != nil {
+			return false, err
+		}
+		for i := range args[1:] {
+			v, err := m.argument(args, i+1, -1)
+			if err != nil {
+				return false, err
+			}
+			if v > 0xFF {
+				return false, fmt.Errorf("%s doesn't fit in a byte", args[i+1])
+			}
+			if err := m.CPU.Memory.SetByte(addr+rune(i), byte(v)); err != nil {
+				return false, err
+			}
+		}
+	case "stack":
+		for i := int(m.CPU.R.SP); i > 0; i-- {
+			fmt.Fprintf(m.Out, "#%d  0x%03X\n", i, m.CPU.R.Stack[i])
+		}
+	case "list", "l":
+		addr, err := m.argument(args, 0, int(m.CPU.R.PC))
+		if err != nil {
+			return false, err
+		}
+		n, err := m.argument(args, 1, 10)
+		if err != nil {
+			return false, err
+		}
+		if len(args) == 0 && addr >= 6 {
+			// a few instructions before the PC, assuming they are 2 bytes long
+			addr -= 6
+		}
+		m.list(addr, int(n))
+	case "press", "release":
+		k, err := m.argument(args, 0, -1)
+		if err != nil {
+			return false, err
+		}
+		if k > 0xF {
+			return false, fmt.Errorf("no key %s on the hex keypad", args[0])
+		}
+		if command == "press" {
+			m.keys.Held |= 1 << uint(k)
+		} else {
+			m.keys.Held &^= 1 << uint(k)
+		}
+	default:
+		return false, fmt.Errorf("unknown command %s, try help", command)
+	}
+
+	return false, nil
+}
+
+// run executes n instructions, or until done when n is negative. It stops early on a breakpoint, the end of the program, a
+// fault, or an instruction which leaves the PC unchanged, like a jump to itself or a wait for a key.
+func (m *Monitor) run(n int, done func() bool) error {
+	c := m.CPU
+	defer func() { m.list(c.R.PC, 1) }()
+
+	for i := 0; n < 0 || i < n; i++ {
+		if c.Exited {
+			fmt.Fprintln(m.Out, "the program exited")
+			return nil
+		}
+
+		res, err := c.Step()
+		if err != nil {
+			return err
+		}
+
+		for _, h := range res.Watch {
+			fmt.Fprintf(m.Out, "watchpoint: %s 0x%02X at 0x%04X by 0x%03X %04X\n", h.Access, h.Value, h.Addr, h.PC, h.Opcode)
+		}
+		if len(res.Watch) > 0 {
+			return nil
+		}
+
+		if done != nil && done() {
+			return nil
+		}
+
+		if m.breakpoints[c.R.PC] && (n < 0 || i < n-1) {
+			fmt.Fprintf(m.Out, "breakpoint at 0x%03X\n", c.R.PC)
+			return nil
+		}
+
+		if n < 0 && res.NextPC == res.PC {
+			fmt.Fprintf(m.Out, "the program is stuck at 0x%03X\n", c.R.PC)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (m *Monitor) watch(args []string) error {
+	access := mmu.Write
+	if n := len(args); n > 1 {
+		switch args[n-1] {
+		case "r":
+			access, args = mmu.Read, args[:n-1]
+		case "w":
+			access, args = mmu.Write, args[:n-1]
+		case "rw":
+			access, args = mmu.Read|mmu.Write, args[:n-1]
+		}
+	}
+
+	start, err := m.argument(args, 0, -1)
+	if err != nil {
+		return err
+	}
+
+	end, err := m.argument(args, 1, int(start))
+	if err != nil {
+		return err
+	}
+
+	id := m.CPU.Watch(cpu.Watchpoint{Start: start, End: end, Access: access})
+	fmt.Fprintf(m.Out, "watchpoint %d on %s of 0x%04X to 0x%04X\n", id, access, start, end)
+	return nil
+}
+
+func (m *Monitor) set(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: set reg value")
+	}
+
+	v, err := parse(args[1])
+	if err != nil {
+		return err
+	}
+
+	r := m.CPU.R
+	name := strings.ToUpper(args[0])
+	if len(name) == 2 && name[0] == 'V' {
+		x, err := strconv.ParseUint(name[1:], 16, 8)
+		if err == nil && v <= 0xFF {
+			r.V[x] = byte(v)
+			return nil
+		}
+	}
+
+	switch {
+	case name == "I" && v <= 0xFFFF:
+		r.I = v
+	case name == "PC" && v <= 0xFFFF:
+		r.PC = v
+	case name == "SP" && int(v) < len(r.Stack):
+		r.SP = byte(v)
+	case name == "DT" && v <= 0xFF:
+		r.DT = byte(v)
+	case name == "ST" && v <= 0xFF:
+		r.ST = byte(v)
+	default:
+		return fmt.Errorf("can't set %s to %s", args[0], args[1])
+	}
+
+	return nil
+}
+
+func (m *Monitor) dump(addr rune, n int) error {
+	for row := 0; row < n; row += 16 {
+		fmt.Fprintf(m.Out, "0x%04X ", addr+rune(row))
+		for i := row; i < row+16 && i < n; i++ {
+			b, err := m.CPU.Memory.GetByte(addr + rune(i))
+			if err != nil {
+				fmt.Fprintln(m.Out)
+				return err
+			}
+			fmt.Fprintf(m.Out, " %02X", b)
+		}
+		fmt.Fprintln(m.Out)
+	}
+
+	return nil
+}
+
+// decode disassembles the instruction at addr.
+func (m *Monitor) decode(addr rune) disasm.Instruction {
+	b := make([]byte, 0, 4)
+	for i := rune(0); i < 4; i++ {
+		v, err := m.CPU.Memory.GetByte(addr + i)
+		if err != nil {
+			break
+		}
+		b = append(b, v)
+	}
+
+	return disasm.Decode(b, addr)
+}
+
+// list disassembles n instructions from addr, marking the PC with > and the breakpoints with *.
+func (m *Monitor) list(addr rune, n int) {
+	for i := 0; i < n; i++ {
+		in := m.decode(addr)
+		if in.Size() == 0 {
+			return
+		}
+
+		mark := ' '
+		if m.breakpoints[addr] {
+			mark = '*'
+		}
+
+		pc := ' '
+		if addr == m.CPU.R.PC {
+			pc = '>'
+		}
+
+		fmt.Fprintf(m.Out, "%c%c %s\n", pc, mark, in)
+		addr += rune(in.Size())
+	}
+}
+
+func (m *Monitor) sortedBreakpoints() []rune {
+	var addrs []int
+	for addr := range m.breakpoints {
+		addrs = append(addrs, int(addr))
+	}
+	sort.Ints(addrs)
+
+	out := make([]rune, len(addrs))
+	for i, addr := range addrs {
+		out[i] = rune(addr)
+	}
+
+	return out
+}
+
+// argument parses args[i], which defaults to def when missing. A negative default makes the argument required.
+func (m *Monitor) argument(args []string, i int, def int) (rune, error) {
+	if i >= len(args) {
+		if def < 0 {
+			return 0, fmt.Errorf("missing argument")
+		}
+		return rune(def), nil
+	}
+
+	return parse(args[i])
+}
+
+func parse(s string) (rune, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+
+	return rune(v), nil
+}
@@ -0,0 +1,68 @@
+package monitor
+
+import (
+	"bytes"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"strings"
+	"testing"
+)
+
+var rom = []byte{
+	0x60, 0x01, // 0x200 LD V0, 0x01
+	0x22, 0x0A, // 0x202 CALL 0x20A
+	0x70, 0x01, // 0x204 ADD V0, 0x01
+	0xF2, 0x0A, // 0x206 LD V2, K
+	0x12, 0x08, // 0x208 JP 0x208
+	0x71, 0x10, // 0x20A ADD V1, 0x10
+	0x00, 0xEE, // 0x20C RET
+}
+
+func newMonitor(script string) (*Monitor, *bytes.Buffer) {
+	var out bytes.Buffer
+	m, _ := New(&cpu.CPU{}, strings.NewReader(script), &out)
+	m.CPU.LoadData(rom)
+	return m, &out
+}
+
+func TestCommands(t *testing.T) {
+	tc := []struct {
+		script   string
+		pc       rune
+		v        [3]byte
+		contains []string
+	}{
+		{"next\nnext\n", 0x204, [3]byte{0x01, 0x10}, []string{">  0x204"}},
+		{"step 3\nfinish\n", 0x204, [3]byte{0x01, 0x10}, nil},
+		{"b 0x204\nc\nbreakpoints\n", 0x204, [3]byte{0x01, 0x10}, []string{"breakpoint at 0x204", "(chip8) 0x204\n"}},
+		{"c\n", 0x206, [3]byte{0x02, 0x10}, []string{"stuck at 0x206"}},
+		{"c\npress 0xA\nstep 20\nrelease 0xA\nstep 20\nc\n", 0x208, [3]byte{0x02, 0x10, 0x0A}, []string{"stuck at 0x208"}},
+		{"set V2 0x33\nset PC 0x204\nregs\n", 0x204, [3]byte{0x00, 0x00, 0x33}, []string{"V2=33", "PC=0204"}},
+		{"poke 0x300 1 2 0xFF\nmem 0x300 3\n", 0x200, [3]byte{}, []string{"0x0300  01 02 FF\n"}},
+		{"step 2\nstack\n", 0x20A, [3]byte{0x01}, []string{"#1  0x204"}},
+		{"list 0x208 2\n", 0x200, [3]byte{}, []string{"0x208  1208", "ADD V1, 0x10"}},
+		{"finish\nfoo\nbreak\nset V0 0x100\n", 0x200, [3]byte{}, []string{"error: not in a subroutine", "error: unknown command foo", "error: missing argument", "error: can't set"}},
+		{"q\nstep\n", 0x200, [3]byte{}, nil},
+		{"poke 0x204 0xF0 0x55\nwatch 0x000 0x00F\nc\n", 0x206, [3]byte{0x01, 0x10}, []string{"watchpoint 1 on write", "write 0x01 at 0x0000 by 0x204 F055"}},
+	}
+
+	for _, c := range tc {
+		m, out := newMonitor(c.script)
+		if err := m.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		if m.CPU.R.PC != c.pc {
+			t.Errorf("%q: PC should be 0x%03X, actual: 0x%03X\n", c.script, c.pc, m.CPU.R.PC)
+		}
+
+		if v := [3]byte{m.CPU.R.V[0], m.CPU.R.V[1], m.CPU.R.V[2]}; v != c.v {
+			t.Errorf("%q: V0 to V2 should be % X, actual: % X\n", c.script, c.v, v)
+		}
+
+		for _, s := range c.contains {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%q: output should contain %q, actual:\n%s", c.script, s, out)
+			}
+		}
+	}
+}
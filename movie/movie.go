@@ -0,0 +1,158 @@
+// Package movie records the inputs of a run so that it can be replayed exactly, and checked against the state it ended with.
+package movie
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/keyboard"
+	"io/ioutil"
+)
+
+// Version is the version of the movie format written by Save.
+const Version = 1
+
+// A Movie holds everything needed to replay a run from the reset of the machine: the ROM it ran, the settings of the CPU and
+// the keypad state of every frame.
+type Movie struct {
+	Version        int
+	ROM            string // hex encoded SHA-1 of the ROM
+	Seed           int64
+	Quirks         cpu.Quirks
+	CyclesPerFrame int
+
+	Frames []uint16 // keypad state polled at the end of each frame, bit k being set when key k is down
+
+	Cycles uint64 // number of instructions executed by the run
+	Hash   string // cpu.StateHash at the end of the run
+}
+
+// MismatchError is returned by Replay when the replayed run doesn't end in the recorded state.
+type MismatchError struct {
+	Expected, Actual string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("replay ended in state %s, the movie expects %s", e.Actual, e.Expected)
+}
+
+// New starts a movie of the run of the ROM by the CPU, with its current settings. The CPU must not be reset yet.
+func New(c *cpu.CPU, rom []byte) *Movie {
+	return &Movie{
+		Version:        Version,
+		ROM:            romHash(rom),
+		Seed:           c.Seed,
+		Quirks:         c.Quirks,
+		CyclesPerFrame: c.CyclesPerFrame,
+	}
+}
+
+// Record returns a source reading the keypad from src, which appends every polled state to the movie.
+func (m *Movie) Record(src keyboard.Source) keyboard.Source {
+	if src == nil {
+		src = keyboard.NullSource{}
+	}
+
+	return &recorder{Source: src, movie: m}
+}
+
+// Finish records the state the run ended in.
+func (m *Movie) Finish(c *cpu.CPU) error {
+	hash, err := c.StateHash()
+	if err != nil {
+		return err
+	}
+
+	m.Cycles = c.Cycles
+	m.Hash = hash
+	return nil
+}
+
+// Replay resets the CPU with the settings of the movie, runs the ROM with the recorded inputs and checks the final state. The
+// renderer and the audio sink of the CPU are kept.
+func (m *Movie) Replay(c *cpu.CPU, rom []byte) error {
+	if hash := romHash(rom); hash != m.ROM {
+		return fmt.Errorf("the movie was recorded with the ROM %s, not %s", m.ROM, hash)
+	}
+
+	c.Seed = m.Seed
+	c.Quirks = m.Quirks
+	c.CyclesPerFrame = m.CyclesPerFrame
+	c.Input = &keyboard.ScriptedSource{Frames: m.Frames}
+	if err := c.Reset(); err != nil {
+		return err
+	}
+
+	if err := c.LoadData(rom); err != nil {
+		return err
+	}
+
+	if _, err := c.StepN(int(m.Cycles)); err != nil {
+		return err
+	}
+
+	hash, err := c.StateHash()
+	if err != nil {
+		return err
+	}
+
+	if c.Cycles != m.Cycles || hash != m.Hash {
+		return &MismatchError{Expected: m.Hash, Actual: hash}
+	}
+
+	return nil
+}
+
+// Save writes the movie as JSON.
+func (m *Movie) Save(path string) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Load reads a movie written by Save.
+func Load(path string) (*Movie, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Movie)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if m.Version != Version {
+		return nil, fmt.Errorf("%s: unsupported movie version %d", path, m.Version)
+	}
+
+	return m, nil
+}
+
+func romHash(rom []byte) string {
+	h := sha1.Sum(rom)
+	return hex.EncodeToString(h[:])
+}
+
+// recorder polls a source on behalf of the keyboard and appends the keypad state to the movie.
+type recorder struct {
+	keyboard.Source
+	movie *Movie
+}
+
+func (r *recorder) Poll(state map[byte]bool) {
+	r.Source.Poll(state)
+
+	var keys uint16
+	for k := byte(0x00); k <= 0x0F; k++ {
+		if state[k] {
+			keys |= 1 << k
+		}
+	}
+	r.movie.Frames = append(r.movie.Frames, keys)
+}
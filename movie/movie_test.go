@@ -0,0 +1,93 @@
+package movie
+
+import (
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/keyboard"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var rom = []byte{
+	0xF0, 0x0A, // LD V0, K
+	0xC1, 0xFF, // RND V1, 0xFF
+	0x82, 0x04, // ADD V2, V0
+	0x12, 0x00, // JP 0x200
+}
+
+func record(t *testing.T, frames []uint16) *Movie {
+	c := &cpu.CPU{Seed: 3, CyclesPerFrame: 2, Quirks: cpu.QuirksVIP}
+	m := New(c, rom)
+	c.Input = m.Record(&keyboard.ScriptedSource{Frames: frames})
+	c.Reset()
+	c.LoadData(rom)
+
+	if err := c.RunFrames(len(frames) + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Finish(c); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestReplay(t *testing.T) {
+	m := record(t, []uint16{0x0000, 0x0020, 0x0000, 0x0000, 0x8000, 0x0000, 0x0000, 0x0000})
+	if len(m.Frames) != 9 {
+		t.Fatalf("movie should have 9 frames, actual: %d\n", len(m.Frames))
+	}
+
+	if m.Frames[1] != 0x0020 || m.Frames[4] != 0x8000 {
+		t.Errorf("frames 1 and 4 should be 0x0020 and 0x8000, actual: 0x%04x and 0x%04x\n", m.Frames[1], m.Frames[4])
+	}
+
+	c := &cpu.CPU{Seed: 99}
+	if err := m.Replay(c, rom); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Seed != 3 || c.R.V[0x2] != 0x14 {
+		t.Errorf("replay should run with seed 3 and end with V2 = 0x14, actual: %d, 0x%02x\n", c.Seed, c.R.V[0x2])
+	}
+
+	m.Frames[4] = 0x4000
+	if err := m.Replay(c, rom); err == nil {
+		t.Errorf("replay with different inputs should fail")
+	} else if _, ok := err.(*MismatchError); !ok {
+		t.Errorf("error should be a *MismatchError, actual: %v\n", err)
+	}
+
+	if err := m.Replay(c, rom[:6]); err == nil {
+		t.Errorf("replay with another ROM should fail")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	m := record(t, []uint16{0x0001, 0x0000})
+
+	f, err := ioutil.TempFile("", "movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := m.Save(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Hash != m.Hash || loaded.Quirks != m.Quirks || len(loaded.Frames) != len(m.Frames) {
+		t.Errorf("loaded movie should be %+v, actual: %+v\n", m, loaded)
+	}
+
+	if err := loaded.Replay(&cpu.CPU{}, rom); err != nil {
+		t.Fatal(err)
+	}
+}
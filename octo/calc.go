@@ -0,0 +1,126 @@
+package octo
+
+import (
+	"math"
+)
+
+func boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func integer(f func(a, b int64) int64) func(a, b float64) float64 {
+	return func(a, b float64) float64 {
+		return float64(f(int64(a), int64(b)))
+	}
+}
+
+// binary are the binary operators of the :calc expressions.
+var binary = map[string]func(a, b float64) float64{
+	"+":   func(a, b float64) float64 { return a + b },
+	"-":   func(a, b float64) float64 { return a - b },
+	"*":   func(a, b float64) float64 { return a * b },
+	"/":   func(a, b float64) float64 { return a / b },
+	"%":   math.Mod,
+	"pow": math.Pow,
+	"min": math.Min,
+	"max": math.Max,
+	"&":   integer(func(a, b int64) int64 { return a & b }),
+	"|":   integer(func(a, b int64) int64 { return a | b }),
+	"^":   integer(func(a, b int64) int64 { return a ^ b }),
+	"<<":  integer(func(a, b int64) int64 { return a << uint64(b) }),
+	">>":  integer(func(a, b int64) int64 { return a >> uint64(b) }),
+	"<":   func(a, b float64) float64 { return boolean(a < b) },
+	">":   func(a, b float64) float64 { return boolean(a > b) },
+	"<=":  func(a, b float64) float64 { return boolean(a <= b) },
+	">=":  func(a, b float64) float64 { return boolean(a >= b) },
+	"==":  func(a, b float64) float64 { return boolean(a == b) },
+	"!=":  func(a, b float64) float64 { return boolean(a != b) },
+}
+
+// unary are the unary operators of the :calc expressions.
+var unary = map[string]func(a float64) float64{
+	"-":     func(a float64) float64 { return -a },
+	"~":     func(a float64) float64 { return float64(^int64(a)) },
+	"!":     func(a float64) float64 { return boolean(a == 0) },
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"abs":   math.Abs,
+	"sqrt":  math.Sqrt,
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+	"sign": func(a float64) float64 {
+		switch {
+		case a > 0:
+			return 1
+		case a < 0:
+			return -1
+		}
+		return 0
+	},
+}
+
+// calc evaluates an expression between braces. Like in Octo, the operators have no precedence and are evaluated from right
+// to left, the parentheses group the terms.
+func (c *compiler) calc() float64 {
+	c.expect("{")
+	v := c.expr()
+	c.expect("}")
+	return v
+}
+
+func (c *compiler) expr() float64 {
+	v := c.term()
+	if f, ok := binary[c.peek()]; ok {
+		c.pos++
+		return f(v, c.expr())
+	}
+
+	return v
+}
+
+func (c *compiler) term() float64 {
+	t := c.nextToken()
+	if t == "(" {
+		v := c.expr()
+		c.expect(")")
+		return v
+	}
+
+	if f, ok := unary[t]; ok {
+		return f(c.term())
+	}
+
+	switch t {
+	case "@":
+		// the byte already written at an address
+		addr := rune(c.term())
+		if addr < Origin || int(addr-Origin) >= len(c.rom) {
+			c.fail("@ 0x%X is outside of the program", addr)
+		}
+		return float64(c.rom[addr-Origin])
+	case "HERE":
+		return float64(c.here)
+	case "PI":
+		return math.Pi
+	case "E":
+		return math.E
+	}
+
+	if v, ok := c.consts[t]; ok {
+		return v
+	}
+
+	if v, ok := c.constant(t); ok {
+		return float64(v)
+	}
+
+	c.fail("undefined symbol %s in expression", t)
+	return 0
+}
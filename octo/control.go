@@ -0,0 +1,205 @@
+package octo
+
+// A condition of if and while: a register compared with a register or a constant, or a key test.
+type condition struct {
+	x     byte
+	op    string
+	isReg bool
+	y     byte // register compared with x
+	kk    byte // constant compared with x
+}
+
+var negations = map[string]string{
+	"==":   "!=",
+	"!=":   "==",
+	"key":  "-key",
+	"-key": "key",
+	"<":    ">=",
+	">=":   "<",
+	">":    "<=",
+	"<=":   ">",
+}
+
+func (c *compiler) condition() condition {
+	cond := condition{x: c.reg(), op: c.nextToken()}
+	if _, ok := negations[cond.op]; !ok {
+		c.fail("invalid comparison %s", cond.op)
+	}
+
+	if cond.op == "key" || cond.op == "-key" {
+		return cond
+	}
+
+	if y, ok := c.register(c.peek()); ok {
+		c.pos++
+		cond.isReg, cond.y = true, y
+	} else {
+		cond.kk = c.byteValue()
+	}
+
+	return cond
+}
+
+func (cond condition) not() condition {
+	cond.op = negations[cond.op]
+	return cond
+}
+
+// skipIf writes the instructions skipping the next one when the condition holds. The comparisons other than == and != use
+// VF: it is set to 1 when the first operand of the subtraction is greater than or equal to the second one, as Octo expects.
+func (c *compiler) skipIf(cond condition) {
+	x := cond.x
+	switch cond.op {
+	case "==":
+		if cond.isReg {
+			c.inst(0x50|x, cond.y<<4)
+		} else {
+			c.inst(0x30|x, cond.kk)
+		}
+	case "!=":
+		if cond.isReg {
+			c.inst(0x90|x, cond.y<<4)
+		} else {
+			c.inst(0x40|x, cond.kk)
+		}
+	case "key":
+		c.inst(0xE0|x, 0x9E)
+	case "-key":
+		c.inst(0xE0|x, 0xA1)
+	case "<", ">=":
+		// VF = x >= rhs
+		if cond.isReg {
+			c.inst(0x8F, x<<4)
+			c.inst(0x8F, cond.y<<4|0x5)
+		} else {
+			c.inst(0x6F, cond.kk)
+			c.inst(0x8F, x<<4|0x7)
+		}
+		c.skipFlag(cond.op == ">=")
+	case ">", "<=":
+		// VF = rhs >= x
+		if cond.isReg {
+			c.inst(0x8F, cond.y<<4)
+		} else {
+			c.inst(0x6F, cond.kk)
+		}
+		c.inst(0x8F, x<<4|0x5)
+		c.skipFlag(cond.op == "<=")
+	}
+}
+
+// skipFlag skips the next instruction when VF is set, or when it is not.
+func (c *compiler) skipFlag(set bool) {
+	if set {
+		c.inst(0x3F, 0x01)
+	} else {
+		c.inst(0x3F, 0x00)
+	}
+}
+
+// ifStatement compiles "if cond then statement" and "if cond begin ... else ... end".
+func (c *compiler) ifStatement() {
+	cond := c.condition()
+	switch t := c.nextToken(); t {
+	case "then":
+		c.skipIf(cond.not())
+	case "begin":
+		c.skipIf(cond)
+		c.blocks = append(c.blocks, &block{jump: c.here, line: c.line})
+		c.inst(0x10, 0x00)
+	default:
+		c.fail("expected then or begin, found %s", t)
+	}
+}
+
+// block returns the innermost block, which must be a loop or a begin.
+func (c *compiler) block(loop bool) *block {
+	if len(c.blocks) == 0 || c.blocks[len(c.blocks)-1].loop != loop {
+		if loop {
+			c.fail("again without loop")
+		}
+		c.fail("else or end without begin")
+	}
+
+	return c.blocks[len(c.blocks)-1]
+}
+
+func (c *compiler) innerLoop() *block {
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if c.blocks[i].loop {
+			return c.blocks[i]
+		}
+	}
+
+	c.fail("while outside of a loop")
+	return nil
+}
+
+// patch sets the address of the jump at addr.
+func (c *compiler) patch(addr, target rune) {
+	if target > 0xFFF {
+		c.fail("jump target 0x%X doesn't fit in 12 bits", target)
+	}
+
+	i := addr - Origin
+	c.rom[i] = 0x10 | byte(target>>8)
+	c.rom[i+1] = byte(target)
+}
+
+// defineMacro compiles ":macro name args { body }".
+func (c *compiler) defineMacro() {
+	name := c.nextToken()
+	m := new(macro)
+	for {
+		t := c.nextToken()
+		if t == "{" {
+			break
+		}
+		m.args = append(m.args, t)
+	}
+
+	depth := 1
+	for {
+		if c.pos >= len(c.tokens) {
+			c.fail("unclosed macro %s", name)
+		}
+
+		t := c.tokens[c.pos]
+		c.pos++
+		if t.text == "{" {
+			depth++
+		} else if t.text == "}" {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+		m.body = append(m.body, t)
+	}
+
+	c.macros[name] = m
+}
+
+// expand replaces the invocation of a macro by its body, with the arguments substituted.
+func (c *compiler) expand(m *macro) {
+	args := make(map[string]string, len(m.args))
+	for _, name := range m.args {
+		args[name] = c.nextToken()
+	}
+
+	c.expanded += len(m.body)
+	if c.expanded > maxExpansion {
+		c.fail("macro expansion too large")
+	}
+
+	body := make([]token, len(m.body))
+	for i, t := range m.body {
+		if v, ok := args[t.text]; ok {
+			t.text = v
+		}
+		body[i] = t
+	}
+
+	rest := append(body, c.tokens[c.pos:]...)
+	c.tokens = append(c.tokens[:c.pos], rest...)
+}
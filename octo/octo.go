@@ -0,0 +1,399 @@
+// Package octo compiles the high-level assembly language of Octo into CHIP-8, SUPER-CHIP and XO-CHIP programs.
+//
+// The program starts at the label main. Unless main is the first label of the source, a jump to main is written at 0x200.
+// Like in Octo, a bare label name calls the subroutine and a bare number is written as a byte. Forward references are
+// allowed in the operands of the instructions, but not in the :calc expressions. :breakpoint and :monitor are accepted and
+// ignored, :stringmode isn't supported.
+package octo
+
+import (
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/asm"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Origin is the address the programs are loaded at.
+const Origin rune = 0x200
+
+// maxExpansion bounds the number of tokens produced by the macros, which stops the macros expanding themselves forever.
+const maxExpansion = 1 << 20
+
+type token struct {
+	text string
+	line asm.Line
+}
+
+type macro struct {
+	args []string
+	body []token
+}
+
+// fixup patches an operand referring to a label defined later.
+type fixup struct {
+	addr  rune
+	label string
+	kind  int
+	line  asm.Line
+}
+
+const (
+	fixAddr       = iota // the 12 bits address of nnnn instructions
+	fixLong              // the 16 bits address following F000
+	fixUnpackHi          // the low nibble of the byte of the first instruction of :unpack
+	fixUnpackLong        // the byte of the first instruction of :unpack long
+	fixUnpackLo          // the byte of the second instruction of :unpack
+)
+
+// block is an open begin, or loop, waiting for its end, or again.
+type block struct {
+	loop   bool
+	start  rune   // address of the loop
+	jump   rune   // address of the jump to patch at else or end
+	breaks []rune // jumps of the while of the loop
+	line   asm.Line
+}
+
+type compiler struct {
+	tokens []token
+	pos    int
+	line   asm.Line // line of the statement being compiled
+
+	rom  []byte
+	here rune
+
+	labels  map[string]rune
+	consts  map[string]float64
+	aliases map[string]byte
+	macros  map[string]*macro
+
+	fixups   []fixup
+	blocks   []*block
+	next     string // label set by :next on the following instruction
+	expanded int
+
+	lines map[rune]asm.Line
+}
+
+// CompileFile compiles the source file at path.
+func CompileFile(path string) (*asm.Program, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Compile(path, src)
+}
+
+// Compile compiles src, read from the file name.
+func Compile(name string, src []byte) (*asm.Program, error) {
+	c := &compiler{
+		tokens:  tokenize(name, string(src)),
+		here:    Origin,
+		labels:  make(map[string]rune),
+		consts:  make(map[string]float64),
+		aliases: make(map[string]byte),
+		macros:  make(map[string]*macro),
+		lines:   make(map[rune]asm.Line),
+	}
+
+	if err := c.compile(); err != nil {
+		return nil, err
+	}
+
+	symbols := make(map[string]rune, len(c.labels)+len(c.consts))
+	for name, v := range c.consts {
+		symbols[name] = rune(int(v))
+	}
+	for name, addr := range c.labels {
+		symbols[name] = addr
+	}
+
+	return &asm.Program{Bytes: c.rom, Symbols: symbols, Lines: c.lines}, nil
+}
+
+// tokenize splits the source on white spaces, dropping the comments which start with # and end with the line.
+func tokenize(name, src string) []token {
+	var tokens []token
+	for i, text := range strings.Split(src, "\n") {
+		if j := strings.Index(text, "#"); j >= 0 {
+			text = text[:j]
+		}
+
+		for _, field := range strings.Fields(text) {
+			tokens = append(tokens, token{field, asm.Line{File: name, Line: i + 1}})
+		}
+	}
+
+	return tokens
+}
+
+// compileError is raised by the helpers of the compiler and turned into an *asm.Error by compile.
+type compileError struct {
+	line asm.Line
+	err  string
+}
+
+func (c *compiler) fail(format string, a ...interface{}) {
+	panic(compileError{c.line, fmt.Sprintf(format, a...)})
+}
+
+func (c *compiler) compile() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			err = &asm.Error{Line: e.line, Err: e.err}
+		}
+	}()
+
+	if len(c.tokens) < 2 || c.tokens[0].text != ":" || c.tokens[1].text != "main" {
+		c.inst(0x10, 0x00)
+		c.fixups = append(c.fixups, fixup{Origin, "main", fixAddr, asm.Line{}})
+	}
+
+	for c.pos < len(c.tokens) {
+		c.line = c.tokens[c.pos].line
+		c.statement()
+	}
+
+	if len(c.blocks) > 0 {
+		c.line = c.blocks[len(c.blocks)-1].line
+		c.fail("unclosed block")
+	}
+
+	if c.next != "" {
+		c.fail(":next %s isn't followed by an instruction", c.next)
+	}
+
+	for _, f := range c.fixups {
+		addr, ok := c.labels[f.label]
+		if !ok {
+			c.line = f.line
+			c.fail("undefined label %s", f.label)
+		}
+
+		i := f.addr - Origin
+		switch f.kind {
+		case fixAddr:
+			if addr > 0xFFF {
+				c.line = f.line
+				c.fail("%s = 0x%X doesn't fit in 12 bits", f.label, addr)
+			}
+			c.rom[i] |= byte(addr >> 8)
+			c.rom[i+1] = byte(addr)
+		case fixLong:
+			c.rom[i] = byte(addr >> 8)
+			c.rom[i+1] = byte(addr)
+		case fixUnpackHi:
+			c.rom[i+1] |= byte(addr>>8) & 0x0F
+		case fixUnpackLong:
+			c.rom[i+1] = byte(addr >> 8)
+		case fixUnpackLo:
+			c.rom[i+1] = byte(addr)
+		}
+	}
+
+	return nil
+}
+
+// peek returns the next token without consuming it, or an empty string at the end of the source.
+func (c *compiler) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+
+	return c.tokens[c.pos].text
+}
+
+func (c *compiler) nextToken() string {
+	if c.pos >= len(c.tokens) {
+		c.fail("unexpected end of source")
+	}
+
+	t := c.tokens[c.pos].text
+	c.pos++
+	return t
+}
+
+func (c *compiler) expect(text string) {
+	if t := c.nextToken(); t != text {
+		c.fail("expected %s, found %s", text, t)
+	}
+}
+
+// emit writes bytes at the current address.
+func (c *compiler) emit(b ...byte) {
+	end := int(c.here-Origin) + len(b)
+	if c.here < Origin || end > 0x10000-int(Origin) {
+		c.fail("address 0x%X out of memory", c.here)
+	}
+
+	for len(c.rom) < end {
+		c.rom = append(c.rom, 0x00)
+	}
+
+	if _, ok := c.lines[c.here]; !ok {
+		c.lines[c.here] = c.line
+	}
+
+	copy(c.rom[c.here-Origin:], b)
+	c.here += rune(len(b))
+}
+
+// inst writes an instruction, binding the label of a preceding :next to its second byte.
+func (c *compiler) inst(hi, lo byte) {
+	if c.next != "" {
+		c.define(c.next, c.here+1)
+		c.next = ""
+	}
+
+	c.emit(hi, lo)
+}
+
+func (c *compiler) define(name string, addr rune) {
+	if _, ok := c.labels[name]; ok {
+		c.fail("label %s already defined", name)
+	}
+
+	if _, ok := c.register(name); ok {
+		c.fail("%s is a register", name)
+	}
+
+	c.labels[name] = addr
+}
+
+// register parses v0 to vF, or an alias.
+func (c *compiler) register(t string) (byte, bool) {
+	if x, ok := c.aliases[t]; ok {
+		return x, true
+	}
+
+	if len(t) != 2 || (t[0] != 'v' && t[0] != 'V') {
+		return 0, false
+	}
+
+	x, err := strconv.ParseUint(t[1:], 16, 8)
+	if err != nil {
+		return 0, false
+	}
+
+	return byte(x), true
+}
+
+func (c *compiler) reg() byte {
+	t := c.nextToken()
+	x, ok := c.register(t)
+	if !ok {
+		c.fail("expected a register, found %s", t)
+	}
+
+	return x
+}
+
+// number parses a decimal, 0x hex or 0b binary number, which may be negative.
+func number(t string) (int, bool) {
+	neg := strings.HasPrefix(t, "-")
+	if neg {
+		t = t[1:]
+	}
+
+	base, digits := 10, t
+	switch {
+	case strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0X"):
+		base, digits = 16, t[2:]
+	case strings.HasPrefix(t, "0b") || strings.HasPrefix(t, "0B"):
+		base, digits = 2, t[2:]
+	}
+
+	v, err := strconv.ParseInt(digits, base, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	if neg {
+		v = -v
+	}
+
+	return int(v), true
+}
+
+// constant returns the value of a number, a constant or a defined label.
+func (c *compiler) constant(t string) (int, bool) {
+	if v, ok := number(t); ok {
+		return v, true
+	}
+
+	if v, ok := c.consts[t]; ok {
+		return int(v), true
+	}
+
+	if addr, ok := c.labels[t]; ok {
+		return int(addr), true
+	}
+
+	return 0, false
+}
+
+// value reads a constant operand in the range min to max.
+func (c *compiler) value(min, max int) int {
+	t := c.nextToken()
+	v, ok := c.constant(t)
+	if !ok {
+		c.fail("undefined constant %s", t)
+	}
+
+	if v < min || v > max {
+		c.fail("%s = %d out of range %d to %d", t, v, min, max)
+	}
+
+	return v
+}
+
+// byteValue reads an operand written as an unsigned or a signed byte.
+func (c *compiler) byteValue() byte {
+	return byte(c.value(-128, 255))
+}
+
+// address reads the operand of an instruction taking an address, the instruction being written at at. Labels not yet
+// defined are patched at the end of the compilation.
+func (c *compiler) address(at rune, kind int, max int) int {
+	t := c.peek()
+	if _, ok := c.constant(t); ok {
+		return c.value(0, max)
+	}
+
+	if !isIdent(t) {
+		c.fail("invalid address %s", t)
+	}
+
+	c.pos++
+	c.fixups = append(c.fixups, fixup{at, t, kind, c.line})
+	return 0
+}
+
+// jump writes an instruction nnnn whose address is the next operand.
+func (c *compiler) jump(opcode rune) {
+	addr := rune(c.address(c.here, fixAddr, 0xFFF))
+	c.inst(byte(opcode>>8)|byte(addr>>8), byte(addr))
+}
+
+func isIdent(t string) bool {
+	if t == "" {
+		return false
+	}
+
+	for i, r := range t {
+		switch {
+		case r == '_' || r == '-' && i > 0, r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,186 @@
+package octo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/asm"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"testing"
+)
+
+func TestCompileStatements(t *testing.T) {
+	tc := []struct {
+		src      string
+		expected []byte
+	}{
+		{"clear return ; hires lores exit", []byte{0x00, 0xE0, 0x00, 0xEE, 0x00, 0xEE, 0x00, 0xFF, 0x00, 0xFE, 0x00, 0xFD}},
+		{"scroll-down 4 scroll-up 2 scroll-left scroll-right", []byte{0x00, 0xC4, 0x00, 0xD2, 0x00, 0xFC, 0x00, 0xFB}},
+		{"v1 := 0x0A v1 += 5 v1 -= 1 v2 := v1", []byte{0x61, 0x0A, 0x71, 0x05, 0x71, 0xFF, 0x82, 0x10}},
+		{"v1 |= v2 v1 &= v2 v1 ^= v2 v1 += v2", []byte{0x81, 0x21, 0x81, 0x22, 0x81, 0x23, 0x81, 0x24}},
+		{"v1 -= v2 v1 >>= v2 v1 =- v2 v1 <<= v2", []byte{0x81, 0x25, 0x81, 0x26, 0x81, 0x27, 0x81, 0x2E}},
+		{"v3 := random 0x0F v3 := key v3 := delay", []byte{0xC3, 0x0F, 0xF3, 0x0A, 0xF3, 0x07}},
+		{"delay := v4 buzzer := v4 pitch := v4", []byte{0xF4, 0x15, 0xF4, 0x18, 0xF4, 0x3A}},
+		{"i := 0x300 i += v5 i := hex v5 i := bighex v5", []byte{0xA3, 0x00, 0xF5, 0x1E, 0xF5, 0x29, 0xF5, 0x30}},
+		{"i := long 0x1234", []byte{0xF0, 0x00, 0x12, 0x34}},
+		{"bcd v6 save v6 load v6 saveflags v6 loadflags v6", []byte{0xF6, 0x33, 0xF6, 0x55, 0xF6, 0x65, 0xF6, 0x75, 0xF6, 0x85}},
+		{"save v1 - v3 load v1 - v3", []byte{0x51, 0x32, 0x51, 0x33}},
+		{"sprite v1 v2 15 plane 3 audio", []byte{0xD1, 0x2F, 0xF3, 0x01, 0xF0, 0x02}},
+		{"jump 0x208 jump0 0x300 :call 0x400", []byte{0x12, 0x08, 0xB3, 0x00, 0x24, 0x00}},
+		{"0xF0 0x90 -1 :byte { 2 * 3 + 1 } :pointer 0x1234", []byte{0xF0, 0x90, 0xFF, 0x08, 0x12, 0x34}},
+		{"if v1 == 2 then v2 := 1 if v1 != v3 then clear", []byte{0x41, 0x02, 0x62, 0x01, 0x51, 0x30, 0x00, 0xE0}},
+		{"if v1 key then clear if v1 -key then clear", []byte{0xE1, 0xA1, 0x00, 0xE0, 0xE1, 0x9E, 0x00, 0xE0}},
+	}
+
+	for _, c := range tc {
+		p, err := Compile("test.8o", []byte(": main "+c.src))
+		if err != nil {
+			t.Errorf("%q should compile, actual: %s\n", c.src, err)
+			continue
+		}
+
+		if !bytes.Equal(p.Bytes, c.expected) {
+			t.Errorf("%q should compile to % X, actual: % X\n", c.src, c.expected, p.Bytes)
+		}
+	}
+}
+
+func TestCompileProgram(t *testing.T) {
+	src := `
+:alias counter v3
+:const STEP 2
+:calc LIMIT { STEP * 5 }
+
+:macro add-to reg value {
+	reg += value
+}
+
+: digits
+	0xF0 0x90 0x90 0x90 0xF0
+
+: main
+	counter := 0
+	loop
+		add-to counter STEP
+		while counter != LIMIT
+	again
+	if counter == LIMIT begin
+		v4 := 1
+	else
+		v4 := 2
+	end
+	setup
+	:unpack 0xA digits
+	:next patched
+	v6 := 0
+: halt
+	jump halt
+
+: setup
+	i := digits
+	v5 := 7
+	;
+`
+	p, err := Compile("test.8o", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Symbols["digits"] != 0x202 || p.Symbols["main"] != 0x207 || p.Symbols["LIMIT"] != 10 {
+		t.Errorf("digits, main and LIMIT should be 0x202, 0x207 and 10, actual: 0x%X, 0x%X, %d\n",
+			p.Symbols["digits"], p.Symbols["main"], p.Symbols["LIMIT"])
+	}
+
+	if p.Bytes[0] != 0x12 || p.Bytes[1] != 0x07 {
+		t.Errorf("program should start with a jump to main, actual: % X\n", p.Bytes[:2])
+	}
+
+	if p.Symbols["patched"] != p.Symbols["halt"]-1 {
+		t.Errorf(":next should label the byte of the following instruction, actual: 0x%X\n", p.Symbols["patched"])
+	}
+
+	if line := p.Lines[p.Symbols["halt"]]; line != (asm.Line{File: "test.8o", Line: 29}) {
+		t.Errorf("halt should map to test.8o:29, actual: %s\n", line)
+	}
+
+	c := &cpu.CPU{}
+	c.Reset()
+	c.LoadData(p.Bytes)
+	if _, err := c.StepN(100); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [16]byte{0xA2, 0x02, 0x00, 0x0A, 0x01, 0x07}
+	if c.R.V != expected || c.R.I != 0x202 {
+		t.Errorf("registers should be %v and I 0x202, actual: %v and I 0x%X\n", expected, c.R.V, c.R.I)
+	}
+}
+
+func TestCompileComparisons(t *testing.T) {
+	ops := []struct {
+		op   string
+		cond func(a, b int) bool
+	}{
+		{"<", func(a, b int) bool { return a < b }},
+		{">", func(a, b int) bool { return a > b }},
+		{"<=", func(a, b int) bool { return a <= b }},
+		{">=", func(a, b int) bool { return a >= b }},
+		{"==", func(a, b int) bool { return a == b }},
+		{"!=", func(a, b int) bool { return a != b }},
+	}
+
+	for _, o := range ops {
+		for _, rhs := range []string{"5", "v2"} {
+			for _, v0 := range []int{4, 5, 6} {
+				src := fmt.Sprintf(": main v0 := %d v2 := 5 v1 := 0 if v0 %s %s then v1 := 1 v3 := 1", v0, o.op, rhs)
+				p, err := Compile("test.8o", []byte(src))
+				if err != nil {
+					t.Errorf("%q should compile, actual: %s\n", src, err)
+					continue
+				}
+
+				c := &cpu.CPU{}
+				c.Reset()
+				c.LoadData(p.Bytes)
+				for c.R.V[3] == 0 {
+					if _, err := c.Step(); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				taken := c.R.V[1] == 1
+				if taken != o.cond(v0, 5) {
+					t.Errorf("if %d %s %s: then branch taken should be %t, actual: %t\n", v0, o.op, rhs, o.cond(v0, 5), taken)
+				}
+			}
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tc := []struct {
+		src  string
+		line int
+	}{
+		{": main\nclear\nfoo-bar", 3},
+		{": main\nv1 := 256", 2},
+		{": main\nloop\nclear", 2},
+		{": main\nend", 2},
+		{": main\n: main", 2},
+		{": main\nv1 += i", 2},
+		{": main\n:calc X { 1 + Y }", 2},
+		{"clear", 0},
+	}
+
+	for _, c := range tc {
+		_, err := Compile("test.8o", []byte(c.src))
+		e, ok := err.(*asm.Error)
+		if !ok {
+			t.Errorf("%q should fail with an *asm.Error, actual: %v\n", c.src, err)
+			continue
+		}
+
+		if e.Line.Line != c.line {
+			t.Errorf("%q should fail on line %d, actual: %s\n", c.src, c.line, e)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package octo
+
+// implicit are the statements without operands.
+var implicit = map[string]rune{
+	"clear":        0x00E0,
+	"return":       0x00EE,
+	";":            0x00EE,
+	"scroll-right": 0x00FB,
+	"scroll-left":  0x00FC,
+	"exit":         0x00FD,
+	"lores":        0x00FE,
+	"hires":        0x00FF,
+	"audio":        0xF002,
+}
+
+// registerOps are the Fx instructions of the form "op vx", kk being the value.
+var registerOps = map[string]byte{
+	"bcd":       0x33,
+	"saveflags": 0x75,
+	"loadflags": 0x85,
+}
+
+// arithmetic are the 8xyn assignments, n being the value.
+var arithmetic = map[string]byte{
+	":=":  0x0,
+	"|=":  0x1,
+	"&=":  0x2,
+	"^=":  0x3,
+	"+=":  0x4,
+	"-=":  0x5,
+	">>=": 0x6,
+	"=-":  0x7,
+	"<<=": 0xE,
+}
+
+func (c *compiler) statement() {
+	t := c.nextToken()
+
+	if opcode, ok := implicit[t]; ok {
+		c.inst(byte(opcode>>8), byte(opcode))
+		return
+	}
+
+	if kk, ok := registerOps[t]; ok {
+		x := c.reg()
+		c.inst(0xF0|x, kk)
+		return
+	}
+
+	if x, ok := c.register(t); ok {
+		c.assign(x)
+		return
+	}
+
+	switch t {
+	case ":":
+		name := c.nextToken()
+		if !isIdent(name) {
+			c.fail("invalid label %s", name)
+		}
+		c.define(name, c.here)
+	case ":const":
+		name := c.nextToken()
+		c.consts[name] = float64(c.value(-0x10000, 0xFFFF))
+	case ":alias":
+		name := c.nextToken()
+		c.aliases[name] = c.reg()
+	case ":unpack":
+		c.unpack()
+	case ":next":
+		c.next = c.nextToken()
+	case ":org":
+		c.here = rune(c.value(int(Origin), 0xFFFF))
+	case ":macro":
+		c.defineMacro()
+	case ":calc":
+		name := c.nextToken()
+		c.consts[name] = c.calc()
+	case ":byte":
+		if c.peek() == "{" {
+			c.emit(byte(int(c.calc())))
+		} else {
+			c.emit(c.byteValue())
+		}
+	case ":pointer":
+		var v int
+		if c.peek() == "{" {
+			v = int(c.calc())
+		} else {
+			v = c.address(c.here, fixLong, 0xFFFF)
+		}
+		c.emit(byte(v>>8), byte(v))
+	case ":call":
+		c.jump(0x2000)
+	case ":assert":
+		message := c.nextToken()
+		if c.calc() == 0 {
+			c.fail("assertion failed: %s", message)
+		}
+	case ":breakpoint":
+		c.nextToken()
+	case ":monitor":
+		c.nextToken()
+		c.nextToken()
+	case "save", "load":
+		x := c.reg()
+		if c.peek() == "-" {
+			c.pos++
+			y := c.reg()
+			n := byte(0x2)
+			if t == "load" {
+				n = 0x3
+			}
+			c.inst(0x50|x, y<<4|n)
+			return
+		}
+		if t == "save" {
+			c.inst(0xF0|x, 0x55)
+		} else {
+			c.inst(0xF0|x, 0x65)
+		}
+	case "sprite":
+		x := c.reg()
+		y := c.reg()
+		n := byte(c.value(0, 15))
+		c.inst(0xD0|x, y<<4|n)
+	case "scroll-down":
+		c.inst(0x00, 0xC0|byte(c.value(0, 15)))
+	case "scroll-up":
+		c.inst(0x00, 0xD0|byte(c.value(0, 15)))
+	case "plane":
+		c.inst(0xF0|byte(c.value(0, 3)), 0x01)
+	case "jump":
+		c.jump(0x1000)
+	case "jump0":
+		c.jump(0xB000)
+	case "delay", "buzzer", "pitch":
+		c.expect(":=")
+		x := c.reg()
+		kk := map[string]byte{"delay": 0x15, "buzzer": 0x18, "pitch": 0x3A}[t]
+		c.inst(0xF0|x, kk)
+	case "i":
+		c.assignI()
+	case "if":
+		c.ifStatement()
+	case "else":
+		b := c.block(false)
+		jump := c.here
+		c.inst(0x10, 0x00)
+		c.patch(b.jump, c.here)
+		b.jump = jump
+	case "end":
+		b := c.block(false)
+		c.patch(b.jump, c.here)
+		c.blocks = c.blocks[:len(c.blocks)-1]
+	case "loop":
+		c.blocks = append(c.blocks, &block{loop: true, start: c.here, line: c.line})
+	case "while":
+		b := c.innerLoop()
+		c.skipIf(c.condition())
+		b.breaks = append(b.breaks, c.here)
+		c.inst(0x10, 0x00)
+	case "again":
+		b := c.block(true)
+		c.inst(0x10|byte(b.start>>8), byte(b.start))
+		for _, addr := range b.breaks {
+			c.patch(addr, c.here)
+		}
+		c.blocks = c.blocks[:len(c.blocks)-1]
+	default:
+		if m, ok := c.macros[t]; ok {
+			c.expand(m)
+			return
+		}
+
+		if _, ok := number(t); ok {
+			c.pos--
+			c.emit(c.byteValue())
+			return
+		}
+
+		if isIdent(t) {
+			// a bare label calls the subroutine
+			c.pos--
+			c.jump(0x2000)
+			return
+		}
+
+		c.fail("unknown statement %s", t)
+	}
+}
+
+// assign compiles the statements starting with a register.
+func (c *compiler) assign(x byte) {
+	op := c.nextToken()
+	rhs := c.peek()
+
+	if y, ok := c.register(rhs); ok {
+		n, ok := arithmetic[op]
+		if !ok {
+			c.fail("invalid operator %s", op)
+		}
+		c.pos++
+		c.inst(0x80|x, y<<4|n)
+		return
+	}
+
+	switch op {
+	case ":=":
+		switch rhs {
+		case "key":
+			c.pos++
+			c.inst(0xF0|x, 0x0A)
+		case "delay":
+			c.pos++
+			c.inst(0xF0|x, 0x07)
+		case "random":
+			c.pos++
+			c.inst(0xC0|x, c.byteValue())
+		default:
+			c.inst(0x60|x, c.byteValue())
+		}
+	case "+=":
+		c.inst(0x70|x, c.byteValue())
+	case "-=":
+		c.inst(0x70|x, -c.byteValue())
+	default:
+		c.fail("invalid operator %s for a constant", op)
+	}
+}
+
+// assignI compiles the statements starting with i.
+func (c *compiler) assignI() {
+	switch op := c.nextToken(); op {
+	case ":=":
+		switch c.peek() {
+		case "hex":
+			c.pos++
+			c.inst(0xF0|c.reg(), 0x29)
+		case "bighex":
+			c.pos++
+			c.inst(0xF0|c.reg(), 0x30)
+		case "long":
+			c.pos++
+			c.inst(0xF0, 0x00)
+			addr := c.address(c.here, fixLong, 0xFFFF)
+			c.emit(byte(addr>>8), byte(addr))
+		default:
+			c.jump(0xA000)
+		}
+	case "+=":
+		c.inst(0xF0|c.reg(), 0x1E)
+	default:
+		c.fail("invalid operator %s for i", op)
+	}
+}
+
+// unpack compiles ":unpack n label", setting v0 to n << 4 | label >> 8 and v1 to the low byte of the label. "long" in place of
+// n sets v0 to the high byte of the label.
+func (c *compiler) unpack() {
+	long := c.peek() == "long"
+	var nibble byte
+	if long {
+		c.pos++
+	} else {
+		nibble = byte(c.value(0, 15)) << 4
+	}
+
+	t := c.nextToken()
+	addr, ok := c.constant(t)
+	if !ok {
+		if !isIdent(t) {
+			c.fail("invalid address %s", t)
+		}
+
+		kind := fixUnpackHi
+		if long {
+			kind = fixUnpackLong
+		}
+		c.fixups = append(c.fixups, fixup{c.here, t, kind, c.line}, fixup{c.here + 2, t, fixUnpackLo, c.line})
+	}
+
+	hi := nibble | byte(addr>>8)&0x0F
+	if long {
+		hi = byte(addr >> 8)
+	}
+	c.inst(0x60, hi)
+	c.inst(0x61, byte(addr))
+}
@@ -0,0 +1,169 @@
+// Package rewind keeps the recent history of a machine, to step backwards in time.
+package rewind
+
+import (
+	"bytes"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+)
+
+// gap is the number of identical bytes under which two changed runs are merged into one.
+const gap = 8
+
+// Buffer is a bounded ring of snapshots of the machine. Only the newest snapshot is kept whole, as a save state holding the
+// registers, the memory and the framebuffer. Each older snapshot is stored as the bytes differing from the snapshot taken
+// right after it, so a frame which touched a few bytes of memory costs a few bytes.
+type Buffer struct {
+	Capacity int // maximum number of snapshots
+	Interval int // frames between two snapshots, 1 when not set
+
+	current []byte // newest snapshot
+	diffs   []diff // ring of the older snapshots, diffs[(head+len-1)%cap] being the newest
+	head, n int
+	frames  int // frames executed since the newest snapshot
+}
+
+// New returns a buffer of capacity snapshots taken every interval frames.
+func New(capacity, interval int) *Buffer {
+	return &Buffer{Capacity: capacity, Interval: interval}
+}
+
+// Len returns the number of snapshots which can be rewound to.
+func (b *Buffer) Len() int {
+	if b.current == nil {
+		return 0
+	}
+
+	return b.n + 1
+}
+
+// Frame is called after each frame, and snapshots the machine every Interval frames.
+func (b *Buffer) Frame(c *cpu.CPU) error {
+	b.frames++
+	if b.current != nil && b.frames < b.interval() {
+		return nil
+	}
+
+	var state bytes.Buffer
+	if err := c.SaveState(&state); err != nil {
+		return err
+	}
+
+	if b.current != nil && b.Capacity > 1 {
+		b.push(newDiff(b.current, state.Bytes()))
+	}
+	b.current = state.Bytes()
+	b.frames = 0
+	return nil
+}
+
+// Rewind restores the newest snapshot, or the one before it when the machine didn't run since. It returns false when the
+// history is empty.
+func (b *Buffer) Rewind(c *cpu.CPU) (bool, error) {
+	if b.current == nil {
+		return false, nil
+	}
+
+	if b.frames == 0 {
+		if b.n == 0 {
+			return false, nil
+		}
+
+		b.current = b.pop().apply(b.current)
+	}
+
+	if err := c.LoadState(bytes.NewReader(b.current)); err != nil {
+		return false, err
+	}
+
+	b.frames = 0
+	return true, nil
+}
+
+// Clear drops the whole history.
+func (b *Buffer) Clear() {
+	b.current = nil
+	b.diffs = nil
+	b.head, b.n = 0, 0
+	b.frames = 0
+}
+
+func (b *Buffer) interval() int {
+	if b.Interval <= 0 {
+		return 1
+	}
+
+	return b.Interval
+}
+
+func (b *Buffer) push(d diff) {
+	size := b.Capacity - 1
+	if b.diffs == nil {
+		b.diffs = make([]diff, size)
+	}
+
+	if b.n == size {
+		// the oldest snapshot is overwritten
+		b.head = (b.head + 1) % size
+		b.n--
+	}
+
+	b.diffs[(b.head+b.n)%size] = d
+	b.n++
+}
+
+func (b *Buffer) pop() diff {
+	b.n--
+	i := (b.head + b.n) % len(b.diffs)
+	d := b.diffs[i]
+	b.diffs[i] = diff{}
+	return d
+}
+
+// A diff turns a snapshot into the older one it was computed from.
+type diff struct {
+	size int // size of the older snapshot
+	runs []run
+}
+
+type run struct {
+	offset int
+	bytes  []byte
+}
+
+// newDiff returns the runs of bytes of old which differ from new. Snapshots of different sizes, after a change of resolution,
+// are stored whole.
+func newDiff(old, new []byte) diff {
+	d := diff{size: len(old)}
+	if len(old) != len(new) {
+		d.runs = []run{{0, append([]byte(nil), old...)}}
+		return d
+	}
+
+	for i := 0; i < len(old); i++ {
+		if old[i] == new[i] {
+			continue
+		}
+
+		start, end := i, i+1
+		for j := end; j < len(old) && j < end+gap; j++ {
+			if old[j] != new[j] {
+				end = j + 1
+			}
+		}
+
+		d.runs = append(d.runs, run{start, append([]byte(nil), old[start:end]...)})
+		i = end - 1
+	}
+
+	return d
+}
+
+func (d diff) apply(new []byte) []byte {
+	old := make([]byte, d.size)
+	copy(old, new)
+	for _, r := range d.runs {
+		copy(old[r.offset:], r.bytes)
+	}
+
+	return old
+}
@@ -0,0 +1,97 @@
+package rewind
+
+import (
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"testing"
+)
+
+var rom = []byte{
+	0x70, 0x01, // ADD V0, 0x01
+	0xA3, 0x00, // LD I, 0x300
+	0xF0, 0x55, // LD [I], V0
+	0x12, 0x00, // JP 0x200
+}
+
+func TestRewind(t *testing.T) {
+	c := &cpu.CPU{CyclesPerFrame: 4}
+	c.Reset()
+	c.LoadData(rom)
+
+	b := New(5, 2)
+	var history []cpu.Registers
+	for i := 0; i < 20; i++ {
+		if err := c.RunFrames(1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.Frame(c); err != nil {
+			t.Fatal(err)
+		}
+
+		if i%2 == 0 {
+			history = append(history, *c.R)
+		}
+	}
+
+	if b.Len() != 5 {
+		t.Errorf("buffer should hold 5 snapshots, actual: %d\n", b.Len())
+	}
+
+	// one frame was executed since the last snapshot, the first rewind goes back to it
+	for i := len(history) - 1; i >= len(history)-5; i-- {
+		ok, err := b.Rewind(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			t.Fatalf("rewind to snapshot %d should succeed\n", i)
+		}
+
+		if *c.R != history[i] {
+			t.Errorf("registers should be %v, actual: %v\n", &history[i], c.R)
+		}
+
+		v, _ := c.Memory.GetByte(0x300)
+		if v != history[i].V[0x0] {
+			t.Errorf("memory at 0x300 should be 0x%02x, actual: 0x%02x\n", history[i].V[0x0], v)
+		}
+	}
+
+	if ok, _ := b.Rewind(c); ok {
+		t.Errorf("rewind past the oldest snapshot should fail")
+	}
+
+	// the history goes on from the rewound state
+	if err := c.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	b.Frame(c)
+	b.Frame(c)
+	if b.Len() != 2 {
+		t.Errorf("buffer should hold 2 snapshots, actual: %d\n", b.Len())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tc := []struct {
+		old, new []byte
+		runs     int
+	}{
+		{[]byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}, 0},
+		{[]byte{1, 2, 3, 4}, []byte{1, 0, 3, 4}, 1},
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, []byte{0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0}, 2},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3, 4}, 1},
+	}
+
+	for _, c := range tc {
+		d := newDiff(c.old, c.new)
+		if len(d.runs) != c.runs {
+			t.Errorf("diff should have %d runs, actual: %d\n", c.runs, len(d.runs))
+		}
+
+		if old := d.apply(c.new); string(old) != string(c.old) {
+			t.Errorf("diff should restore %v, actual: %v\n", c.old, old)
+		}
+	}
+}
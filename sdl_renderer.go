@@ -0,0 +1,65 @@
+package main
+
+import "github.com/veandco/go-sdl2/sdl"
+
+// palette binds each combination of planes to a colour.
+var palette = [4]uint32{
+	0x000000, // no plane
+	0xFFFFFF, // first plane
+	0xAAAAAA, // second plane
+	0x555555, // both planes
+}
+
+// sdlRenderer draws the framebuffer in an SDL window, each cell of the initial framebuffer being a Scale x Scale square.
+// The window keeps its size when the resolution changes.
+type sdlRenderer struct {
+	Scale   int
+	Window  *sdl.Window
+	Surface *sdl.Surface
+
+	width int // width of the window in pixels
+}
+
+func (r *sdlRenderer) Init(width, height int) error {
+	var err error
+
+	if r.Scale == 0 {
+		r.Scale = 10
+	}
+
+	if r.Window != nil {
+		return nil
+	}
+	r.width = width * r.Scale
+
+	if err = sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+		return err
+	}
+
+	r.Window, err = sdl.CreateWindow("go chip8", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, width*r.Scale, height*r.Scale, sdl.WINDOW_SHOWN)
+	if err != nil {
+		return err
+	}
+
+	r.Surface, err = r.Window.GetSurface()
+	return err
+}
+
+func (r *sdlRenderer) Draw(cells [][]byte) error {
+	if len(cells) == 0 {
+		return nil
+	}
+	size := r.width / len(cells[0])
+
+	for y := range cells {
+		for x := range cells[y] {
+			color := palette[cells[y][x]&0x03]
+			rect := &sdl.Rect{X: int32(x * size), Y: int32(y * size), W: int32(size), H: int32(size)}
+			if err := r.Surface.FillRect(rect, color); err != nil {
+				return err
+			}
+		}
+	}
+
+	return r.Window.UpdateSurface()
+}
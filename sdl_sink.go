@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/jordanabderrachid/go-chip8/timer"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// maxQueued is the number of frames of audio queued in SDL above which the queue is dropped, to keep the latency low when
+// the emulation runs faster than the audio device.
+const maxQueued = 6
+
+// sdlSink plays the samples on the default SDL audio device.
+type sdlSink struct {
+	Device sdl.AudioDeviceID
+
+	sampleRate int
+	buf        []byte
+}
+
+func (s *sdlSink) Init(sampleRate int) error {
+	s.sampleRate = sampleRate
+	if s.Device != 0 {
+		return nil
+	}
+
+	if err := sdl.InitSubSystem(sdl.INIT_AUDIO); err != nil {
+		return err
+	}
+
+	spec := &sdl.AudioSpec{
+		Freq:     int32(sampleRate),
+		Format:   sdl.AUDIO_S8,
+		Channels: 1,
+		Samples:  1024,
+	}
+
+	dev, err := sdl.OpenAudioDevice("", 0, spec, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	s.Device = dev
+	sdl.PauseAudioDevice(s.Device, 0)
+	return nil
+}
+
+func (s *sdlSink) Write(samples []int8) error {
+	if sdl.GetQueuedAudioSize(s.Device) > uint32(int64(maxQueued*s.sampleRate)/timer.Frenquency) {
+		sdl.ClearQueuedAudio(s.Device)
+	}
+
+	if cap(s.buf) < len(samples) {
+		s.buf = make([]byte, len(samples))
+	}
+	s.buf = s.buf[:len(samples)]
+	for i, v := range samples {
+		s.buf[i] = byte(v)
+	}
+
+	return sdl.QueueAudio(s.Device, s.buf)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/keyboard"
+	"github.com/veandco/go-sdl2/sdl"
+	"strconv"
+	"strings"
+)
+
+// sdlSource reads the SDL keyboard state and the state of every connected game controller and joystick. The SDL events must
+// be pumped between two polls for the state to change.
+type sdlSource struct {
+	keys      map[sdl.Keycode]byte
+	scancodes map[sdl.Scancode]byte // resolved on the first poll, once SDL knows the keyboard layout
+
+	buttons    map[sdl.GameControllerButton]byte
+	joyButtons map[int]byte
+	joyHats    map[uint8]byte
+
+	devices     int // number of joysticks when the devices were last opened
+	controllers []*sdl.GameController
+	joysticks   []*sdl.Joystick // joysticks which are not game controllers
+}
+
+// newSDLSource returns a source reading the inputs of the binding. The game controller and joystick inputs were checked by
+// Binding.Keys, only the key names are left for SDL to check.
+func newSDLSource(b keyboard.Binding) (*sdlSource, error) {
+	keys, err := b.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sdlSource{
+		keys:       make(map[sdl.Keycode]byte),
+		buttons:    make(map[sdl.GameControllerButton]byte),
+		joyButtons: make(map[int]byte),
+		joyHats:    make(map[uint8]byte),
+		devices:    -1,
+	}
+
+	for name, k := range keys {
+		switch {
+		case strings.HasPrefix(name, "pad:"):
+			btn := keyboard.PadButtons[strings.TrimPrefix(name, "pad:")]
+			s.buttons[sdl.GameControllerButton(btn)] = k
+		case strings.HasPrefix(name, "joy:button"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(name, "joy:button"))
+			s.joyButtons[n] = k
+		case strings.HasPrefix(name, "joy:"):
+			s.joyHats[keyboard.JoyDirections[strings.TrimPrefix(name, "joy:")]] = k
+		default:
+			code := sdl.GetKeyFromName(name)
+			if code == sdl.K_UNKNOWN {
+				return nil, fmt.Errorf("unknown key name %q", name)
+			}
+			s.keys[code] = k
+		}
+	}
+
+	return s, nil
+}
+
+func (s *sdlSource) Poll(state map[byte]bool) {
+	if s.scancodes == nil {
+		s.scancodes = make(map[sdl.Scancode]byte, len(s.keys))
+		for code, k := range s.keys {
+			s.scancodes[sdl.GetScancodeFromKey(code)] = k
+		}
+	}
+
+	keyboardState := sdl.GetKeyboardState()
+	for code, k := range s.scancodes {
+		if int(code) < len(keyboardState) && keyboardState[code] == 1 {
+			state[k] = true
+		}
+	}
+
+	if len(s.buttons)+len(s.joyButtons)+len(s.joyHats) == 0 {
+		return
+	}
+
+	if n := sdl.NumJoysticks(); n != s.devices {
+		s.openDevices(n)
+	}
+
+	for _, c := range s.controllers {
+		for btn, k := range s.buttons {
+			if c.GetButton(btn) == 1 {
+				state[k] = true
+			}
+		}
+	}
+
+	for _, j := range s.joysticks {
+		for btn, k := range s.joyButtons {
+			if j.GetButton(btn) == 1 {
+				state[k] = true
+			}
+		}
+
+		if j.NumHats() == 0 {
+			continue
+		}
+
+		hat := j.GetHat(0)
+		for dir, k := range s.joyHats {
+			if hat&dir != 0 {
+				state[k] = true
+			}
+		}
+	}
+}
+
+// openDevices opens every connected device, as a game controller when SDL knows its mapping, as a joystick otherwise.
+func (s *sdlSource) openDevices(n int) {
+	if s.devices < 0 {
+		sdl.InitSubSystem(sdl.INIT_GAMECONTROLLER)
+	}
+
+	for _, c := range s.controllers {
+		c.Close()
+	}
+	for _, j := range s.joysticks {
+		j.Close()
+	}
+	s.controllers, s.joysticks = nil, nil
+
+	for i := 0; i < n; i++ {
+		if sdl.IsGameController(i) {
+			if c := sdl.GameControllerOpen(i); c != nil {
+				s.controllers = append(s.controllers, c)
+			}
+		} else if j := sdl.JoystickOpen(sdl.JoystickID(i)); j != nil {
+			s.joysticks = append(s.joysticks, j)
+		}
+	}
+
+	s.devices = n
+}
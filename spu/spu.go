@@ -1 +1,103 @@
 package spu
+
+import "math"
+
+const (
+	DefaultSampleRate int = 48000
+	frameRate         int = 60 // Hz, rate of the sound timer
+	volume            int = 64 // amplitude of the samples
+)
+
+// SquareWave is the pattern played when the program did not load one, a 500Hz square wave at the default pitch.
+var SquareWave = [16]byte{
+	0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0,
+	0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0, 0xF0,
+}
+
+// A Sink plays the samples produced by the SPU, as signed 8 bits mono samples.
+//
+// Init is called once by SPU.Reset with the sample rate, then Write is called with the samples of each frame.
+type Sink interface {
+	Init(sampleRate int) error
+	Write(samples []int8) error
+}
+
+// SPU generates the sound of the buzzer: the 128 bits of the pattern buffer are played in a loop while the sound timer is
+// active, each bit being a high or a low sample.
+type SPU struct {
+	Sink       Sink // defaults to a NullSink when nil
+	SampleRate int  // defaults to DefaultSampleRate when zero
+
+	phase   float64 // position in the pattern, in bits
+	samples []int8
+}
+
+func (s *SPU) Reset() error {
+	if s.Sink == nil {
+		s.Sink = NullSink{}
+	}
+
+	if s.SampleRate == 0 {
+		s.SampleRate = DefaultSampleRate
+	}
+
+	if err := s.Sink.Init(s.SampleRate); err != nil {
+		return err
+	}
+
+	s.phase = 0
+	s.samples = make([]int8, s.SampleRate/frameRate)
+	return nil
+}
+
+// Frame produces and writes the samples of one 60Hz frame. While on, the pattern is played at 4000*2^((pitch-64)/48) bits per
+// second, otherwise the frame is silent.
+func (s *SPU) Frame(on bool, pattern [16]byte, pitch byte) error {
+	if !on {
+		s.phase = 0
+		for i := range s.samples {
+			s.samples[i] = 0
+		}
+
+		return s.Sink.Write(s.samples)
+	}
+
+	rate := 4000 * math.Pow(2, (float64(pitch)-64)/48)
+	step := rate / float64(s.SampleRate)
+	for i := range s.samples {
+		bit := int(s.phase) % 128
+		if pattern[bit/8]&(0x80>>uint(bit%8)) != 0 {
+			s.samples[i] = int8(volume)
+		} else {
+			s.samples[i] = int8(-volume)
+		}
+
+		s.phase = math.Mod(s.phase+step, 128)
+	}
+
+	return s.Sink.Write(s.samples)
+}
+
+// NullSink discards every sample.
+type NullSink struct{}
+
+func (NullSink) Init(sampleRate int) error { return nil }
+
+func (NullSink) Write(samples []int8) error { return nil }
+
+// MemorySink keeps every written sample in memory.
+type MemorySink struct {
+	SampleRate int
+	Samples    []int8
+}
+
+func (m *MemorySink) Init(sampleRate int) error {
+	m.SampleRate = sampleRate
+	m.Samples = nil
+	return nil
+}
+
+func (m *MemorySink) Write(samples []int8) error {
+	m.Samples = append(m.Samples, samples...)
+	return nil
+}
@@ -1 +1,53 @@
 package spu
+
+import "testing"
+
+func TestReset(t *testing.T) {
+	s := &SPU{}
+	s.Reset()
+
+	if _, ok := s.Sink.(NullSink); !ok {
+		t.Errorf("sink should default to NullSink, got %T", s.Sink)
+	}
+
+	if s.SampleRate != DefaultSampleRate {
+		t.Errorf("sample rate should default to %d, got %d", DefaultSampleRate, s.SampleRate)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	sink := new(MemorySink)
+	s := &SPU{Sink: sink, SampleRate: 8000}
+	s.Reset()
+
+	if err := s.Frame(false, SquareWave, 64); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.Samples) != 8000/60 {
+		t.Fatalf("a frame should be %d samples, got %d", 8000/60, len(sink.Samples))
+	}
+
+	for i, v := range sink.Samples {
+		if v != 0 {
+			t.Fatalf("sample %d should be silent, got %d", i, v)
+		}
+	}
+
+	if err := s.Frame(true, SquareWave, 64); err != nil {
+		t.Fatal(err)
+	}
+
+	// At 4000 bits per second and 8000 samples per second, each bit of 0xF0 lasts 2 samples: 8 high then 8 low.
+	on := sink.Samples[8000/60:]
+	for i := 0; i < 32; i++ {
+		expected := int8(volume)
+		if i%16 >= 8 {
+			expected = int8(-volume)
+		}
+
+		if on[i] != expected {
+			t.Errorf("sample %d should be %d, got %d", i, expected, on[i])
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package trace writes the traces of the instructions executed by a CPU, as JSON lines or in a compact binary format, and
+// reads the binary format back.
+//
+// A binary trace starts with the magic "C8TR" and a version, both big-endian like the rest of the format. Each record holds:
+//
+//	uvarint  cycle, minus the cycle of the previous record
+//	uint16   PC
+//	byte     size of the instruction, then its bytes
+//	byte     number of register deltas, then for each: byte register, uint16 old value, uint16 new value
+//	uvarint  number of memory writes, then for each: uint16 address, byte value
+//
+// The mnemonics aren't stored, the reader decodes them from the bytes of the instructions.
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"github.com/jordanabderrachid/go-chip8/disasm"
+	"io"
+)
+
+// Magic starts the binary traces.
+const Magic = "C8TR"
+
+// Version is the version of the binary format written by BinaryWriter.
+const Version uint16 = 1
+
+// A Writer is a Tracer writing to a file, which must be flushed at the end of the trace.
+type Writer interface {
+	cpu.Tracer
+	Flush() error
+}
+
+// NewWriter returns a writer of the format, json or binary.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case "json":
+		return NewJSONWriter(w), nil
+	case "binary":
+		return NewBinaryWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unknown trace format %q", format)
+}
+
+// JSONWriter writes a JSON object per instruction and per line. It must be flushed at the end of the trace.
+type JSONWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+type jsonRegister struct {
+	Name string `json:"name"`
+	Old  rune   `json:"old"`
+	New  rune   `json:"new"`
+}
+
+type jsonWrite struct {
+	Addr  string `json:"addr"`
+	Value byte   `json:"value"`
+}
+
+type jsonTrace struct {
+	Cycle     uint64         `json:"cycle"`
+	PC        string         `json:"pc"`
+	Opcode    string         `json:"opcode"`
+	Mnemonic  string         `json:"mnemonic"`
+	Registers []jsonRegister `json:"registers,omitempty"`
+	Writes    []jsonWrite    `json:"writes,omitempty"`
+}
+
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	bw := bufio.NewWriter(w)
+	return &JSONWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// Trace writes the trace. The errors are kept until Flush.
+func (jw *JSONWriter) Trace(t *cpu.Trace) {
+	if jw.err != nil {
+		return
+	}
+
+	jt := jsonTrace{
+		Cycle:    t.Cycle,
+		PC:       fmt.Sprintf("0x%04X", t.PC),
+		Opcode:   fmt.Sprintf("%X", t.Bytes),
+		Mnemonic: t.Mnemonic,
+	}
+	for _, d := range t.Registers {
+		jt.Registers = append(jt.Registers, jsonRegister{d.Name(), d.Old, d.New})
+	}
+	for _, wr := range t.Writes {
+		jt.Writes = append(jt.Writes, jsonWrite{fmt.Sprintf("0x%04X", wr.Addr), wr.Value})
+	}
+
+	jw.err = jw.enc.Encode(jt)
+}
+
+// Flush writes the buffered traces, and returns the first error of the writer.
+func (jw *JSONWriter) Flush() error {
+	if jw.err != nil {
+		return jw.err
+	}
+
+	return jw.w.Flush()
+}
+
+// BinaryWriter writes the traces in the binary format. It must be flushed at the end of the trace.
+type BinaryWriter struct {
+	w      *bufio.Writer
+	header bool
+	cycle  uint64
+	buf    []byte
+	err    error
+}
+
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	return &BinaryWriter{w: bufio.NewWriter(w)}
+}
+
+// Trace writes the trace. The errors are kept until Flush.
+func (bw *BinaryWriter) Trace(t *cpu.Trace) {
+	if bw.err != nil {
+		return
+	}
+
+	b := bw.buf[:0]
+	if !bw.header {
+		b = append(b, Magic...)
+		b = appendUint16(b, Version)
+		bw.header = true
+	}
+
+	b = appendUvarint(b, t.Cycle-bw.cycle)
+	bw.cycle = t.Cycle
+	b = appendUint16(b, uint16(t.PC))
+	b = append(b, byte(len(t.Bytes)))
+	b = append(b, t.Bytes...)
+
+	b = append(b, byte(len(t.Registers)))
+	for _, d := range t.Registers {
+		b = append(b, d.Register)
+		b = appendUint16(b, uint16(d.Old))
+		b = appendUint16(b, uint16(d.New))
+	}
+
+	b = appendUvarint(b, uint64(len(t.Writes)))
+	for _, wr := range t.Writes {
+		b = appendUint16(b, uint16(wr.Addr))
+		b = append(b, wr.Value)
+	}
+
+	bw.buf = b
+	_, bw.err = bw.w.Write(b)
+}
+
+// Flush writes the buffered traces, and returns the first error of the writer.
+func (bw *BinaryWriter) Flush() error {
+	if bw.err != nil {
+		return bw.err
+	}
+
+	return bw.w.Flush()
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// Reader reads the traces of the binary format.
+type Reader struct {
+	r      *bufio.Reader
+	header bool
+	cycle  uint64
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next trace, or io.EOF at the end of the traces.
+func (tr *Reader) Read() (*cpu.Trace, error) {
+	if !tr.header {
+		var h [6]byte
+		if _, err := io.ReadFull(tr.r, h[:]); err != nil {
+			return nil, err
+		}
+		if string(h[:4]) != Magic {
+			return nil, fmt.Errorf("not a trace file")
+		}
+		if v := binary.BigEndian.Uint16(h[4:]); v != Version {
+			return nil, fmt.Errorf("unsupported trace version %d", v)
+		}
+		tr.header = true
+	}
+
+	delta, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the end of the file is only expected between two records
+	t, err := tr.record(tr.cycle + delta)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tr.cycle = t.Cycle
+	return t, nil
+}
+
+func (tr *Reader) record(cycle uint64) (*cpu.Trace, error) {
+	t := &cpu.Trace{Cycle: cycle}
+
+	pc, err := tr.uint16()
+	if err != nil {
+		return nil, err
+	}
+	t.PC = rune(pc)
+
+	n, err := tr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	t.Bytes = make([]byte, n)
+	if _, err := io.ReadFull(tr.r, t.Bytes); err != nil {
+		return nil, err
+	}
+	if n >= 2 {
+		t.Opcode = rune(t.Bytes[0])<<8 | rune(t.Bytes[1])
+	}
+	t.Mnemonic = disasm.Decode(t.Bytes, t.PC).Mnemonic
+
+	n, err = tr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(n); i++ {
+		var d cpu.RegisterDelta
+		if d.Register, err = tr.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		old, err := tr.uint16()
+		if err != nil {
+			return nil, err
+		}
+		v, err := tr.uint16()
+		if err != nil {
+			return nil, err
+		}
+		d.Old, d.New = rune(old), rune(v)
+		t.Registers = append(t.Registers, d)
+	}
+
+	writes, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < writes; i++ {
+		addr, err := tr.uint16()
+		if err != nil {
+			return nil, err
+		}
+		v, err := tr.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		t.Writes = append(t.Writes, cpu.MemoryWrite{Addr: rune(addr), Value: v})
+	}
+
+	return t, nil
+}
+
+func (tr *Reader) uint16() (uint16, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(tr.r, b[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(b[:]), nil
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"bytes"
+	"github.com/jordanabderrachid/go-chip8/cpu"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var rom = []byte{
+	0x60, 0x7B, // 0x200 LD V0, 0x7B
+	0xF0, 0x00, 0x03, 0x00, // 0x202 LD I, LONG 0x300
+	0xF0, 0x33, // 0x206 LD B, V0
+	0x22, 0x0C, // 0x208 CALL 0x20C
+	0x00, 0xFD, // 0x20A EXIT
+	0x00, 0xEE, // 0x20C RET
+}
+
+// copies keeps copies of the traces, which are reused by the CPU.
+type copies []cpu.Trace
+
+func (c *copies) Trace(t *cpu.Trace) {
+	cp := *t
+	cp.Bytes = append([]byte(nil), t.Bytes...)
+	cp.Registers = append([]cpu.RegisterDelta(nil), t.Registers...)
+	cp.Writes = append([]cpu.MemoryWrite(nil), t.Writes...)
+	*c = append(*c, cp)
+}
+
+type tracers []cpu.Tracer
+
+func (ts tracers) Trace(t *cpu.Trace) {
+	for _, tr := range ts {
+		tr.Trace(t)
+	}
+}
+
+func run(t *testing.T, tracer cpu.Tracer) {
+	c := &cpu.CPU{Tracer: tracer}
+	c.Reset()
+	c.LoadData(rom)
+	if _, err := c.StepN(100); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	var b bytes.Buffer
+	w := NewBinaryWriter(&b)
+	expected := new(copies)
+	run(t, tracers{w, expected})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(&b)
+	for i, e := range *expected {
+		tr, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(*tr, e) {
+			t.Errorf("trace %d should be %+v, actual: %+v\n", i, e, *tr)
+		}
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("the traces should end with io.EOF, actual: %v\n", err)
+	}
+
+	if _, err := NewReader(strings.NewReader("C8TR\x00\x01\x01\x02")).Read(); err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated record should fail with io.ErrUnexpectedEOF, actual: %v\n", err)
+	}
+
+	if _, err := NewReader(strings.NewReader("C8ST\x00\x01")).Read(); err == nil {
+		t.Error("a file without the magic should fail")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var b bytes.Buffer
+	w := NewJSONWriter(&b)
+	run(t, w)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	expected := []string{
+		`{"cycle":0,"pc":"0x0200","opcode":"607B","mnemonic":"LD V0, 0x7B","registers":[{"name":"V0","old":0,"new":123}]}`,
+		`{"cycle":1,"pc":"0x0202","opcode":"F0000300","mnemonic":"LD I, LONG 0x0300","registers":[{"name":"I","old":0,"new":768}]}`,
+		`{"cycle":2,"pc":"0x0206","opcode":"F033","mnemonic":"LD B, V0","writes":[{"addr":"0x0300","value":1},{"addr":"0x0301","value":2},{"addr":"0x0302","value":3}]}`,
+		`{"cycle":3,"pc":"0x0208","opcode":"220C","mnemonic":"CALL 0x20C","registers":[{"name":"SP","old":0,"new":1}]}`,
+		`{"cycle":4,"pc":"0x020C","opcode":"00EE","mnemonic":"RET","registers":[{"name":"SP","old":1,"new":0}]}`,
+		`{"cycle":5,"pc":"0x020A","opcode":"00FD","mnemonic":"EXIT"}`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("the JSON lines should be\n%s\nactual:\n%s\n", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	if _, err := NewWriter(&b, "xml"); err == nil {
+		t.Error("an unknown format should fail")
+	}
+}